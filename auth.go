@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// signatureHeader carries the HMAC-SHA256 of outgoing webhook bodies as "sha256=<hex>".
+const signatureHeader = "X-Wahelper-Signature"
+
+// authorized reports whether r carries the configured API token as a bearer token.
+// Without --api-token every request is accepted.
+func (c *Client) authorized(r *http.Request) bool {
+	if c.Config.APIToken == "" {
+		return true
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(c.Config.APIToken)) == 1
+}
+
+// webhookSecret returns the key used to sign webhooks, falling back to the API token.
+func (c *Client) webhookSecret() string {
+	if c.Config.WebhookSecret != "" {
+		return c.Config.WebhookSecret
+	}
+	return c.Config.APIToken
+}
+
+// signPayload returns the value of the signature header for body, or "" when no key is configured.
+func (c *Client) signPayload(body []byte) string {
+	secret := c.webhookSecret()
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// listenAddress resolves --listen into a host:port pair. A bare host gets --port appended.
+// Binding to anything but loopback requires --api-token, so that the command endpoint
+// is never exposed to the network without authentication.
+func (c *Client) listenAddress() (string, error) {
+	listen := c.Config.Listen
+	if listen == "" {
+		listen = "localhost"
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		host = listen
+		port = fmt.Sprintf("%d", c.Config.HTTPPort)
+	}
+	if c.Config.APIToken == "" && !isLoopbackHost(host) {
+		return "", fmt.Errorf("refusing to listen on %s without --api-token", host)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Bulk job and recipient states.
+const (
+	BulkStatusPending   = "pending"
+	BulkStatusRunning   = "running"
+	BulkStatusSent      = "sent"
+	BulkStatusFailed    = "failed"
+	BulkStatusCompleted = "completed"
+)
+
+// BulkJobSpec describes what a bulk job sends and how fast.
+type BulkJobSpec struct {
+	// Kind is text, image, video, audio, voice or document
+	Kind      string        `json:"kind"`
+	Text      string        `json:"text"`
+	MediaPath string        `json:"media_path,omitempty"`
+	FileName  string        `json:"file_name,omitempty"`
+	Delay     time.Duration `json:"delay"`
+	Jitter    time.Duration `json:"jitter"`
+	PerMinute int           `json:"per_minute"`
+	// Media is the upload sent to every recipient of a media job
+	Media *UploadedMedia `json:"media,omitempty"`
+}
+
+// BulkRecipient is a single recipient of a bulk job with its template variables.
+type BulkRecipient struct {
+	JID       string            `json:"jid"`
+	Vars      map[string]string `json:"vars,omitempty"`
+	Status    string            `json:"status"`
+	MessageID string            `json:"message_id,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// BulkJob is a bulk job with its recipients.
+type BulkJob struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	Created    time.Time       `json:"created"`
+	Spec       BulkJobSpec     `json:"spec"`
+	Counts     map[string]int  `json:"counts"`
+	Recipients []BulkRecipient `json:"recipients,omitempty"`
+}
+
+// BulkStore persists bulk jobs and the per-recipient delivery status so that jobs
+// can be inspected and resumed after a restart.
+type BulkStore struct {
+	db *sql.DB
+}
+
+func NewBulkStore(db *sql.DB) *BulkStore {
+	return &BulkStore{db: db}
+}
+
+func (s *BulkStore) Upgrade() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS wahelper_bulk_jobs (
+			job_id     TEXT PRIMARY KEY,
+			status     TEXT   NOT NULL,
+			spec       TEXT   NOT NULL,
+			created_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS wahelper_bulk_recipients (
+			job_id     TEXT    NOT NULL REFERENCES wahelper_bulk_jobs(job_id) ON DELETE CASCADE,
+			position   INTEGER NOT NULL,
+			jid        TEXT    NOT NULL,
+			vars       TEXT    NOT NULL DEFAULT '{}',
+			status     TEXT    NOT NULL,
+			message_id TEXT    NOT NULL DEFAULT '',
+			error      TEXT    NOT NULL DEFAULT '',
+			updated_at BIGINT  NOT NULL,
+			PRIMARY KEY (job_id, jid)
+		)`,
+	}
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create bulk tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateJob stores a new job and its recipients. Duplicate recipients are only stored once.
+func (s *BulkStore) CreateJob(id string, spec BulkJobSpec, recipients []BulkRecipient) error {
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	_, err = tx.Exec(`INSERT INTO wahelper_bulk_jobs (job_id, status, spec, created_at) VALUES ($1, $2, $3, $4)`,
+		id, BulkStatusPending, string(specJSON), now)
+	if err != nil {
+		return fmt.Errorf("failed to save bulk job: %w", err)
+	}
+	for i, recipient := range recipients {
+		varsJSON, err := json.Marshal(recipient.Vars)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO wahelper_bulk_recipients (job_id, position, jid, vars, status, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (job_id, jid) DO NOTHING`,
+			id, i, recipient.JID, string(varsJSON), BulkStatusPending, now)
+		if err != nil {
+			return fmt.Errorf("failed to save bulk recipient: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *BulkStore) SetJobStatus(id, status string) error {
+	_, err := s.db.Exec(`UPDATE wahelper_bulk_jobs SET status=$1 WHERE job_id=$2`, status, id)
+	return err
+}
+
+func (s *BulkStore) SetRecipientStatus(id, jid, status, messageID, errMsg string) error {
+	_, err := s.db.Exec(`UPDATE wahelper_bulk_recipients SET status=$1, message_id=$2, error=$3, updated_at=$4 WHERE job_id=$5 AND jid=$6`,
+		status, messageID, errMsg, time.Now().Unix(), id, jid)
+	return err
+}
+
+// GetJob loads a job. If onlyStatus is set, only recipients with that status are loaded.
+// It returns nil if the job doesn't exist.
+func (s *BulkStore) GetJob(id string, onlyStatus string) (*BulkJob, error) {
+	job := &BulkJob{ID: id, Counts: make(map[string]int)}
+	var specJSON string
+	var created int64
+	err := s.db.QueryRow(`SELECT status, spec, created_at FROM wahelper_bulk_jobs WHERE job_id=$1`, id).Scan(&job.Status, &specJSON, &created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	job.Created = time.Unix(created, 0)
+	if err = json.Unmarshal([]byte(specJSON), &job.Spec); err != nil {
+		return nil, fmt.Errorf("failed to parse job spec: %w", err)
+	}
+
+	rows, err := s.db.Query(`SELECT jid, vars, status, message_id, error FROM wahelper_bulk_recipients WHERE job_id=$1 ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var recipient BulkRecipient
+		var varsJSON string
+		if err = rows.Scan(&recipient.JID, &varsJSON, &recipient.Status, &recipient.MessageID, &recipient.Error); err != nil {
+			return nil, err
+		}
+		job.Counts[recipient.Status]++
+		if onlyStatus != "" && recipient.Status != onlyStatus {
+			continue
+		}
+		if err = json.Unmarshal([]byte(varsJSON), &recipient.Vars); err != nil {
+			return nil, fmt.Errorf("failed to parse recipient variables: %w", err)
+		}
+		job.Recipients = append(job.Recipients, recipient)
+	}
+	return job, rows.Err()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+	"wahelper/utils"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func weekdayIndex(name string) (int, error) {
+	for i, day := range weekdays {
+		if strings.EqualFold(name, day) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", name)
+}
+
+// parseDays expands "mon-fri", "sat,sun", "mon,wed-fri" or "daily" into day names.
+func parseDays(value string) ([]string, error) {
+	if value == "daily" {
+		return nil, nil
+	}
+	var days []string
+	for _, part := range strings.Split(value, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := weekdayIndex(from)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = weekdayIndex(to); err != nil {
+				return nil, err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, weekdays[day])
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseCallWindow parses a --call-hours window "[days] HH:MM-HH:MM" into the same
+// TimeWindow used by rules. Without days it applies every day.
+func parseCallWindow(value string) (TimeWindow, error) {
+	var window TimeWindow
+	fields := strings.Fields(value)
+	if len(fields) == 1 {
+		fields = []string{"daily", fields[0]}
+	} else if len(fields) != 2 {
+		return window, fmt.Errorf("invalid window %q, expected [days] HH:MM-HH:MM", value)
+	}
+	var err error
+	window.Days, err = parseDays(fields[0])
+	if err != nil {
+		return window, err
+	}
+	var found bool
+	window.From, window.To, found = strings.Cut(fields[1], "-")
+	if !found {
+		return window, fmt.Errorf("invalid window %q, expected [days] HH:MM-HH:MM", value)
+	}
+	if _, err = parseClock(window.From); err != nil {
+		return window, fmt.Errorf("invalid time in window %q: %w", value, err)
+	} else if _, err = parseClock(window.To); err != nil {
+		return window, fmt.Errorf("invalid time in window %q: %w", value, err)
+	}
+	return window, nil
+}
+
+func parseCallWindows(values []string) ([]TimeWindow, error) {
+	windows := make([]TimeWindow, 0, len(values))
+	for _, value := range values {
+		window, err := parseCallWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// callAllowed reports whether a call from caller may ring through: the caller is on
+// --call-allow, or the call comes in during one of the --call-hours windows.
+func (c *Client) callAllowed(caller types.JID, at time.Time) bool {
+	for _, allowed := range c.Config.CallAllowlist {
+		jid, ok := utils.ParseJID(allowed)
+		if ok && jid.User == caller.User {
+			return true
+		}
+	}
+	for i := range c.callWindows {
+		if c.callWindows[i].contains(at.Local()) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCallEvent returns a webhook event about a call.
+func (c *Client) newCallEvent(eventType string, meta types.BasicCallMeta, call *WebhookCall) *WebhookEvent {
+	event := c.newWebhookEvent(eventType)
+	event.Timestamp = meta.Timestamp
+	event.Sender = &WebhookSender{JID: meta.From.ToNonAD().String()}
+	call.CallID = meta.CallID
+	call.Creator = meta.CallCreator.ToNonAD().String()
+	event.Call = call
+	return event
+}
+
+// reportCall forwards a call event to the webhook in --mode both.
+func (c *Client) reportCall(event *WebhookEvent) {
+	if c.Config.Mode == "both" {
+		c.sendWebhookEvent(event)
+	}
+}
+
+// claimCallReply reports whether caller may get a --call-reply now, recording the reply
+// if so. Callers who keep redialing get one reply per --call-reply-cooldown.
+func (c *Client) claimCallReply(caller types.JID) bool {
+	c.callReplyLock.Lock()
+	defer c.callReplyLock.Unlock()
+	now := time.Now()
+	for user, repliedAt := range c.callReplies {
+		if now.Sub(repliedAt) >= c.Config.CallReplyCooldown {
+			delete(c.callReplies, user)
+		}
+	}
+	if _, ok := c.callReplies[caller.User]; ok {
+		return false
+	}
+	c.callReplies[caller.User] = now
+	return true
+}
+
+// handleCallOffer reports an incoming call and rejects it if --reject-calls is set and
+// the call isn't allowed, replying to the caller with --call-reply at most once per cooldown.
+func (c *Client) handleCallOffer(meta types.BasicCallMeta, isVideo, isGroup bool) {
+	kind := "voice"
+	if isVideo {
+		kind = "video"
+	}
+	c.Logger.Infof("Incoming %s call %s from %s", kind, meta.CallID, meta.From)
+	call := &WebhookCall{IsVideo: isVideo, IsGroup: isGroup}
+	if c.Config.RejectCalls && !c.callAllowed(meta.From, meta.Timestamp) {
+		err := c.WAClient.RejectCall(meta.From, meta.CallID)
+		if err != nil {
+			c.Logger.Errorf("Failed to reject call %s from %s: %v", meta.CallID, meta.From, err)
+		} else {
+			c.Logger.Infof("Rejected call %s from %s", meta.CallID, meta.From)
+			call.Rejected = true
+		}
+	}
+	c.reportCall(c.newCallEvent("call_offer", meta, call))
+
+	if call.Rejected && c.Config.CallReply != "" && c.claimCallReply(meta.From) {
+		msg := &waProto.Message{Conversation: proto.String(c.Config.CallReply)}
+		_, err := c.sendMessage(meta.From.ToNonAD(), msg)
+		if err != nil {
+			c.Logger.Errorf("Failed to send call reply to %s: %v", meta.From, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestParseCallWindow(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TimeWindow
+		wantErr string
+	}{
+		{"09:00-17:00", TimeWindow{From: "09:00", To: "17:00"}, ""},
+		{"daily 22:00-06:00", TimeWindow{From: "22:00", To: "06:00"}, ""},
+		{"mon-fri 09:00-17:00", TimeWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "09:00", To: "17:00"}, ""},
+		{"Sat,SUN 10:00-12:00", TimeWindow{Days: []string{"sat", "sun"}, From: "10:00", To: "12:00"}, ""},
+		{"mon,wed-fri 08:00-09:00", TimeWindow{Days: []string{"mon", "wed", "thu", "fri"}, From: "08:00", To: "09:00"}, ""},
+		{"fri-mon 18:00-20:00", TimeWindow{Days: []string{"fri", "sat", "sun", "mon"}, From: "18:00", To: "20:00"}, ""},
+		{"weekdays 09:00-17:00", TimeWindow{}, `invalid day "weekdays"`},
+		{"mon-funday 09:00-17:00", TimeWindow{}, `invalid day "funday"`},
+		{"mon 09:00", TimeWindow{}, "expected [days] HH:MM-HH:MM"},
+		{"mon 09:00-17:00 extra", TimeWindow{}, "expected [days] HH:MM-HH:MM"},
+		{"9am-5pm", TimeWindow{}, "invalid time"},
+		{"09:00-24:00", TimeWindow{}, "invalid time"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			window, err := parseCallWindow(test.value)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseCallWindow() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseCallWindow() error = %v", err)
+			}
+			if !reflect.DeepEqual(window, test.want) {
+				t.Errorf("parseCallWindow() = %+v, want %+v", window, test.want)
+			}
+		})
+	}
+}
+
+func TestCallAllowed(t *testing.T) {
+	windows, err := parseCallWindows([]string{"mon-fri 09:00-17:00", "sun 22:00-02:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{
+		Config:      &Config{CallAllowlist: []string{"15551230001", "15551230002@s.whatsapp.net"}},
+		callWindows: windows,
+	}
+	stranger := types.NewJID("15559999999", types.DefaultUserServer)
+
+	tests := []struct {
+		name   string
+		caller types.JID
+		at     time.Time
+		want   bool
+	}{
+		{"allowlisted phone", types.NewADJID("15551230001", 0, 1), monday(3, 0).AddDate(0, 0, 5), true},
+		{"allowlisted JID", types.NewJID("15551230002", types.DefaultUserServer), monday(3, 0).AddDate(0, 0, 5), true},
+		{"office hours", stranger, monday(12, 0), true},
+		{"after office hours", stranger, monday(17, 0), false},
+		{"weekend", stranger, monday(12, 0).AddDate(0, 0, 5), false},
+		{"sunday night", stranger, monday(23, 0).AddDate(0, 0, -1), true},
+		// The hours after midnight belong to the day the window starts on
+		{"monday early", stranger, monday(1, 0), true},
+		{"tuesday early", stranger, monday(1, 0).AddDate(0, 0, 1), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := c.callAllowed(test.caller, test.at); got != test.want {
+				t.Errorf("callAllowed(%s) = %v, want %v", test.at.Format("Mon 15:04"), got, test.want)
+			}
+		})
+	}
+}
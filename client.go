@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -53,16 +54,36 @@ type Client struct {
 	DefaultJID       string
 	WaitGroup        sync.WaitGroup
 	WaitSync         sync.WaitGroup
-	GroupInfo        GroupInfo
-	UpdatedGroupInfo bool
+	Groups           *GroupCache
 	KeepAliveTimeout bool
 	HTTPServer       *http.Server
 	ServerRunning    bool
 	CurrentDir       string
 	FFmpegScriptPath string
 	PairRejectChan   chan bool
+	DB               *sql.DB
+	Polls            *PollStore
+	History          *MessageStore
+	Rules            *RuleEngine
+	Bulk             *BulkStore
+	Schedules        *ScheduleStore
+	Receipts         *ReceiptStore
+	BackgroundJobs   sync.WaitGroup
 
-	commandHandlers map[string]func(args []string) error
+	// StdinMedia allows a single media read from stdin ("-"). It is set for the command
+	// given on the command line only, since stdin carries commands otherwise.
+	StdinMedia atomic.Bool
+
+	callWindows    []TimeWindow
+	callReplyLock  sync.Mutex
+	callReplies    map[string]time.Time
+	bulkLock       sync.Mutex
+	bulkRunning    map[string]bool
+	recentLock     sync.Mutex
+	recentMessages map[types.MessageID]*events.Message
+	recentOrder    []types.MessageID
+
+	commandHandlers map[string]func(args []string) (*CommandResult, error)
 }
 
 type Config struct {
@@ -72,18 +93,48 @@ type Config struct {
 	DBAddress       string `long:"db-address" description:"Database address" default:"file:wahelper.db?_foreign_keys=on"`
 	RequestFullSync bool   `long:"request-full-sync" description:"Request full (1 year) history sync when logging in?"`
 	HTTPPort        int    `long:"port" description:"HTTP server port" default:"7774"`
+	Listen          string `long:"listen" description:"HTTP server listen address as host or host:port, non-loopback addresses require --api-token" default:"localhost"`
+	APIToken        string `long:"api-token" description:"Bearer token required by the HTTP command endpoint"`
 	Mode            string `long:"mode" description:"Select mode: none, both, send" default:"none"`
 	SaveMedia       bool   `long:"save-media" description:"Save Media"`
 	AutoDelete      bool   `long:"auto-delete-media" description:"Delete downloaded media after 30s"`
+	RulesFile       string `long:"rules-file" description:"YAML or JSON file with auto-reply rules, reloaded on change"`
+	ScheduleMissed  string `long:"schedule-missed" description:"What to do with scheduled jobs missed while wahelper wasn't running" choice:"catchup" choice:"skip" default:"catchup"`
+
+	RejectCalls       bool          `long:"reject-calls" description:"Reject incoming calls that aren't allowed by --call-allow or --call-hours"`
+	CallReply         string        `long:"call-reply" description:"Text sent to callers whose call was rejected, empty to send nothing" default:"Sorry, this number can't take calls. Please send a message instead."`
+	CallReplyCooldown time.Duration `long:"call-reply-cooldown" description:"Minimum time between two --call-reply messages to the same caller" default:"1h"`
+	CallAllowlist     []string      `long:"call-allow" description:"JID or phone number whose calls are never rejected, can be repeated"`
+	CallHours         []string      `long:"call-hours" description:"Local time window when calls aren't rejected as '[days] HH:MM-HH:MM', e.g. 'mon-fri 09:00-17:00', can be repeated"`
+
+	MediaMaxSize int64         `long:"media-max-size" description:"Maximum size in bytes of media sent from a URL, data: URI or stdin" default:"104857600"`
+	MediaTimeout time.Duration `long:"media-timeout" description:"Timeout for downloading media sent from a URL" default:"60s"`
+
+	WebhookURLs        []string      `long:"webhook-url" description:"URL to POST received events to, can be repeated (events aren't forwarded without one)"`
+	WebhookHeaders     []string      `long:"webhook-header" description:"Extra header for webhook requests as 'Name: value', can be repeated"`
+	WebhookTimeout     time.Duration `long:"webhook-timeout" description:"Timeout for a single webhook request" default:"10s"`
+	WebhookRetries     int           `long:"webhook-retries" description:"Retries with exponential backoff before a webhook event is queued on disk" default:"5"`
+	WebhookQueueDir    string        `long:"webhook-queue-dir" description:"Directory where undeliverable webhook events are queued" default:"webhook-queue"`
+	WebhookQueueMax    int           `long:"webhook-queue-max" description:"Maximum number of queued webhook events, the oldest are dropped beyond it (0 for no limit)" default:"10000"`
+	WebhookQueueMaxAge time.Duration `long:"webhook-queue-max-age" description:"Queued webhook events older than this are dropped" default:"72h"`
+	WebhookSecret      string        `long:"webhook-secret" description:"HMAC-SHA256 key for the X-Wahelper-Signature header (default: --api-token)"`
+	WebhookSchema      string        `long:"webhook-schema" description:"Webhook payload format: current (typed, with schema_version) or legacy (the original string fields)" choice:"current" choice:"legacy" default:"current"`
 }
 
-type Group struct {
-	JID  string `json:"JID"`
-	Name string `json:"Name"`
+// CommandResult is what a command handler produced, reported back to HTTP callers in sync mode.
+type CommandResult struct {
+	MessageID string
+	Timestamp time.Time
+	Data      interface{}
 }
 
-type GroupInfo struct {
-	Groups []Group `json:"groups"`
+// CommandResponse is the JSON body returned by the HTTP command endpoint in sync mode.
+type CommandResponse struct {
+	OK        bool        `json:"ok"`
+	Error     string      `json:"error,omitempty"`
+	MessageID string      `json:"message_id,omitempty"`
+	Timestamp int64       `json:"timestamp,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
 }
 
 func NewClient(config *Config) (*Client, error) {
@@ -105,12 +156,54 @@ func NewClient(config *Config) (*Client, error) {
 	logger := waLog.Stdout("Main", config.LogLevel, true)
 
 	dbLog := waLog.Stdout("Database", config.LogLevel, true)
-	storeContainer, err := sqlstore.New(config.DBDialect, config.DBAddress, dbLog)
+	db, err := sql.Open(config.DBDialect, config.DBAddress)
+	if err != nil {
+		logger.Errorf("Failed to open database: %v", err)
+		return nil, err
+	}
+	// Our own tables live next to the whatsmeow ones, so share the connection with the sqlstore container
+	storeContainer := sqlstore.NewWithDB(db, config.DBDialect, dbLog)
+	err = storeContainer.Upgrade()
 	if err != nil {
 		logger.Errorf("Failed to connect to database: %v", err)
 		return nil, err
 	}
 
+	polls := NewPollStore(db)
+	err = polls.Upgrade()
+	if err != nil {
+		logger.Errorf("Failed to upgrade poll store: %v", err)
+		return nil, err
+	}
+
+	history := NewMessageStore(db)
+	err = history.Upgrade()
+	if err != nil {
+		logger.Errorf("Failed to upgrade message store: %v", err)
+		return nil, err
+	}
+
+	bulk := NewBulkStore(db)
+	err = bulk.Upgrade()
+	if err != nil {
+		logger.Errorf("Failed to upgrade bulk store: %v", err)
+		return nil, err
+	}
+
+	schedules := NewScheduleStore(db)
+	err = schedules.Upgrade()
+	if err != nil {
+		logger.Errorf("Failed to upgrade schedule store: %v", err)
+		return nil, err
+	}
+
+	receipts := NewReceiptStore(db)
+	err = receipts.Upgrade()
+	if err != nil {
+		logger.Errorf("Failed to upgrade receipt store: %v", err)
+		return nil, err
+	}
+
 	device, err := storeContainer.GetFirstDevice()
 	if err != nil {
 		logger.Errorf("Failed to get device: %v", err)
@@ -124,11 +217,35 @@ func NewClient(config *Config) (*Client, error) {
 		Logger:          logger,
 		Config:          config,
 		PairRejectChan:  make(chan bool, 1),
-		commandHandlers: make(map[string]func(args []string) error),
+		DB:              db,
+		Polls:           polls,
+		History:         history,
+		Bulk:            bulk,
+		Schedules:       schedules,
+		Receipts:        receipts,
+		Groups:          NewGroupCache(),
+		bulkRunning:     make(map[string]bool),
+		callReplies:     make(map[string]time.Time),
+		recentMessages:  make(map[types.MessageID]*events.Message),
+		commandHandlers: make(map[string]func(args []string) (*CommandResult, error)),
+	}
+
+	client.callWindows, err = parseCallWindows(config.CallHours)
+	if err != nil {
+		logger.Errorf("Invalid --call-hours: %v", err)
+		return nil, err
 	}
 
 	client.registerCommands()
 
+	if config.RulesFile != "" {
+		client.Rules, err = NewRuleEngine(client, config.RulesFile)
+		if err != nil {
+			logger.Errorf("Failed to load rules: %v", err)
+			return nil, err
+		}
+	}
+
 	client.CurrentDir, _ = os.Getwd()
 	client.FFmpegScriptPath = filepath.Join(filepath.Dir(client.CurrentDir), "wahelper", "ffmpeg", "ffmpeg")
 
@@ -140,15 +257,28 @@ func (c *Client) registerCommands() {
 	c.commandHandlers["send"] = c.handleSendCommand
 	c.commandHandlers["sendlist"] = c.handleSendListCommand
 	c.commandHandlers["sendpoll"] = c.handleSendPollCommand
+	c.commandHandlers["pollresults"] = c.handlePollResultsCommand
 	c.commandHandlers["sendlink"] = c.handleSendLinkCommand
 	c.commandHandlers["senddoc"] = c.handleSendDocumentCommand
 	c.commandHandlers["sendvid"] = c.handleSendVideoCommand
 	c.commandHandlers["sendaudio"] = c.handleSendAudioCommand
+	c.commandHandlers["sendvoice"] = c.handleSendVoiceCommand
 	c.commandHandlers["sendimg"] = c.handleSendImageCommand
+	c.commandHandlers["sendsticker"] = c.handleSendStickerCommand
+	c.commandHandlers["sendlocation"] = c.handleSendLocationCommand
+	c.commandHandlers["sendcontact"] = c.handleSendContactCommand
 	c.commandHandlers["react"] = c.handleReactCommand
 	c.commandHandlers["revoke"] = c.handleRevokeCommand
+	c.commandHandlers["edit"] = c.handleEditCommand
 	c.commandHandlers["markread"] = c.handleMarkReadCommand
+	c.commandHandlers["tagall"] = c.handleTagAllCommand
 	c.commandHandlers["batchmessagegroupmembers"] = c.handleBatchMessageGroupMembersCommand
+	c.commandHandlers["bulksend"] = c.handleBulkSendCommand
+	c.commandHandlers["bulkstatus"] = c.handleBulkStatusCommand
+	c.commandHandlers["bulkresume"] = c.handleBulkResumeCommand
+	c.commandHandlers["schedule"] = c.handleScheduleCommand
+	c.commandHandlers["schedules"] = c.handleSchedulesCommand
+	c.commandHandlers["unschedule"] = c.handleUnscheduleCommand
 
 	// Group management commands
 	c.commandHandlers["getgroup"] = c.handleGetGroupCommand
@@ -166,6 +296,7 @@ func (c *Client) registerCommands() {
 
 	// Account and privacy commands
 	c.commandHandlers["pair-phone"] = c.handlePairPhoneCommand
+	c.commandHandlers["pair-qr"] = c.handlePairQRCommand
 	c.commandHandlers["logout"] = c.handleLogoutCommand
 	c.commandHandlers["setpushname"] = c.handleSetPushNameCommand
 	c.commandHandlers["setstatus"] = c.handleSetStatusCommand
@@ -186,6 +317,11 @@ func (c *Client) registerCommands() {
 	c.commandHandlers["getnewslettermessages"] = c.handleGetNewsletterMessagesCommand
 	c.commandHandlers["createnewsletter"] = c.handleCreateNewsletterCommand
 
+	// History commands
+	c.commandHandlers["history"] = c.handleHistoryCommand
+	c.commandHandlers["msgstatus"] = c.handleMsgStatusCommand
+	c.commandHandlers["search"] = c.handleSearchCommand
+
 	// Miscellaneous commands
 	c.commandHandlers["reconnect"] = c.handleReconnectCommand
 	c.commandHandlers["appstate"] = c.handleAppStateCommand
@@ -259,19 +395,9 @@ func (c *Client) EventHandler(rawEvt interface{}) {
 				c.Logger.Infof("Marked self as available")
 				c.IsConnected = true
 
+				c.refreshGroups()
+
 				if c.Config.Mode == "both" {
-					c.UpdatedGroupInfo = false
-					groups, err := c.WAClient.GetJoinedGroups()
-					if err == nil {
-						c.GroupInfo.Groups = []Group{}
-						for _, group := range groups {
-							c.GroupInfo.Groups = append(c.GroupInfo.Groups, Group{
-								JID:  group.JID.String(),
-								Name: group.Name,
-							})
-						}
-					}
-					c.UpdatedGroupInfo = true
 					c.Logger.Infof("Receive/Send Mode Enabled")
 					c.Logger.Infof("Will Now Receive/Send Messages In Tasker")
 					// Start any necessary processes here
@@ -293,19 +419,9 @@ func (c *Client) EventHandler(rawEvt interface{}) {
 			c.Logger.Infof("Marked self as available")
 			c.IsConnected = true
 
+			c.refreshGroups()
+
 			if c.Config.Mode == "both" {
-				c.UpdatedGroupInfo = false
-				groups, err := c.WAClient.GetJoinedGroups()
-				if err == nil {
-					c.GroupInfo.Groups = []Group{}
-					for _, group := range groups {
-						c.GroupInfo.Groups = append(c.GroupInfo.Groups, Group{
-							JID:  group.JID.String(),
-							Name: group.Name,
-						})
-					}
-				}
-				c.UpdatedGroupInfo = true
 				c.Logger.Infof("Receive/Send Mode Enabled")
 				c.Logger.Infof("Will Now Receive/Send Messages In Tasker")
 				// Start any necessary processes here
@@ -315,6 +431,10 @@ func (c *Client) EventHandler(rawEvt interface{}) {
 				// Start any necessary processes here
 			}
 		}
+	case *events.PairSuccess:
+		c.Logger.Infof("Paired as %s (platform: %q, business name: %q)", evt.ID, evt.Platform, evt.BusinessName)
+	case *events.PairError:
+		c.Logger.Errorf("Failed to pair as %s: %v", evt.ID, evt.Error)
 	case *events.StreamReplaced:
 		c.Logger.Infof("Stream replaced, exiting")
 		os.Exit(0)
@@ -327,19 +447,52 @@ func (c *Client) EventHandler(rawEvt interface{}) {
 			metaParts = append(metaParts, fmt.Sprintf("type: %s", evt.Info.Type))
 		}
 		c.Logger.Infof("Received message %s from %s (%s): %+v", evt.Info.ID, evt.Info.SourceString(), strings.Join(metaParts, ", "), evt.Message)
+		c.cacheRecentMessage(evt)
+		err := c.History.SaveMessage(evt)
+		if err != nil {
+			c.Logger.Warnf("Failed to record message %s: %v", evt.Info.ID, err)
+		}
+		if c.Rules != nil {
+			go c.Rules.Apply(evt)
+		}
+		// Votes on our polls are tallied in every mode so that pollresults works
+		var pollVote *WebhookPollVote
+		if content, _, _ := unwrapMessage(evt.Message); content.GetPollUpdateMessage() != nil {
+			pollVote = c.recordPollVote(evt, content.GetPollUpdateMessage())
+		}
 
 		if c.Config.Mode == "both" {
 			if c.IsConnected {
 				c.WaitGroup.Add(1)
 			}
-			go c.ParseReceivedMessage(evt, &c.WaitGroup)
+			go c.ParseReceivedMessage(evt, pollVote, &c.WaitGroup)
+		}
+	case *events.HistorySync:
+		if c.Config.RequestFullSync {
+			go c.recordHistorySync(evt)
 		}
 	case *events.Receipt:
 		if evt.Type == types.ReceiptTypeRead || evt.Type == types.ReceiptTypeReadSelf {
 			c.Logger.Infof("%v was read by %s at %s", evt.MessageIDs, evt.SourceString(), evt.Timestamp)
 		} else if evt.Type == types.ReceiptTypeDelivered {
-			c.Logger.Infof("%s was delivered to %s at %s", evt.MessageIDs[0], evt.SourceString(), evt.Timestamp)
+			c.Logger.Infof("%v was delivered to %s at %s", evt.MessageIDs, evt.SourceString(), evt.Timestamp)
 		}
+		go c.handleReceipt(evt)
+	case *events.JoinedGroup:
+		go c.handleJoinedGroup(evt)
+	case *events.GroupInfo:
+		go c.handleGroupInfo(evt)
+	case *events.CallOffer:
+		isVideo := evt.Data != nil && evt.Data.GetChildByTag("video").Tag == "video"
+		go c.handleCallOffer(evt.BasicCallMeta, isVideo, false)
+	case *events.CallOfferNotice:
+		go c.handleCallOffer(evt.BasicCallMeta, evt.Media == "video", evt.Type == "group")
+	case *events.CallAccept:
+		c.Logger.Infof("Call %s from %s was accepted", evt.CallID, evt.From)
+		go c.reportCall(c.newCallEvent("call_accepted", evt.BasicCallMeta, &WebhookCall{}))
+	case *events.CallTerminate:
+		c.Logger.Infof("Call %s from %s ended: %s", evt.CallID, evt.From, evt.Reason)
+		go c.reportCall(c.newCallEvent("call_terminated", evt.BasicCallMeta, &WebhookCall{Reason: evt.Reason}))
 	case *events.Presence:
 		if evt.Unavailable {
 			if evt.LastSeen.IsZero() {
@@ -390,97 +543,53 @@ func (c *Client) EventHandler(rawEvt interface{}) {
 	}
 }
 
-func (c *Client) ParseReceivedMessage(evt *events.Message, wg *sync.WaitGroup) {
+func (c *Client) ParseReceivedMessage(evt *events.Message, pollVote *WebhookPollVote, wg *sync.WaitGroup) {
 	// Implement your message parsing logic here
 	defer wg.Done()
 
-    // Wait until group info is updated
-    for !c.UpdatedGroupInfo {
-        time.Sleep(1 * time.Second)
-        if c.UpdatedGroupInfo {
-            break
-        }
-    }
-
-    isSupported := false
-    jsonData := "{}"
+    // Look inside ephemeral, view once and other wrappers
+    content, isViewOnce, isEphemeral := unwrapMessage(evt.Message)
+    event := c.newMessageEvent(evt, content)
+    event.IsViewOnce = isViewOnce || evt.IsViewOnce
+    event.IsEphemeral = isEphemeral || evt.IsEphemeral
+    statusMessage := event.IsStatus
     path := ""
-    port := fmt.Sprintf("%d", c.Config.HTTPPort)
-    messageID := evt.Info.ID
-    senderPushName := evt.Info.PushName
-    senderJID := evt.Info.Sender.String()
-    receiverJID := evt.Info.Chat.String()
-    timeStamp := fmt.Sprintf("%d", evt.Info.Timestamp.Unix())
-    isFromMyself := ""
-    if evt.Info.MessageSource.IsFromMe {
-        isFromMyself = "true"
-    } else {
-        isFromMyself = "false"
-        if senderJID == receiverJID && c.DefaultJID != "" {
-            receiverJID = c.DefaultJID
-        }
-    }
-    isGroup := ""
-    statusMessage := false
-    groupName := ""
-    if evt.Info.MessageSource.IsGroup && receiverJID != "status@broadcast" {
-        isGroup = "true"
-        for _, group := range c.GroupInfo.Groups {
-            if group.JID == receiverJID {
-                groupName = group.Name
-                break
-            }
-        }
-
-        if groupName != "" {
-            jsonData, _ = utils.AppendToJSON(jsonData, "group_name", groupName)
-        } else {
-            jsonData, _ = utils.AppendToJSON(jsonData, "group_name", "Unknown, Group Not Found")
-        }
-    } else {
-        isGroup = "false"
-    }
-    if receiverJID == "status@broadcast" {
-        receiverJID = c.DefaultJID
-        statusMessage = true
-    }
-
-    jsonData, _ = utils.AppendToJSON(jsonData, "port", port)
-    jsonData, _ = utils.AppendToJSON(jsonData, "sender_jid", senderJID)
-    jsonData, _ = utils.AppendToJSON(jsonData, "receiver_jid", receiverJID)
-    jsonData, _ = utils.AppendToJSON(jsonData, "sender_pushname", senderPushName)
-    jsonData, _ = utils.AppendToJSON(jsonData, "is_from_myself", isFromMyself)
-    jsonData, _ = utils.AppendToJSON(jsonData, "is_group", isGroup)
-    jsonData, _ = utils.AppendToJSON(jsonData, "time_stamp", timeStamp)
 
     // Handle different message types
-    if text := evt.Message.GetConversation(); text != "" {
+    if protocolMsg := content.GetProtocolMessage(); protocolMsg.GetType() == waProto.ProtocolMessage_MESSAGE_EDIT {
+        // Edited message
+        event.Type = "message_edited"
+        event.EditedType, event.Text, _ = messageContent(protocolMsg.GetEditedMessage())
+        event.OriginalMessageID = protocolMsg.GetKey().GetId()
+    } else if protocolMsg := content.GetProtocolMessage(); protocolMsg.GetType() == waProto.ProtocolMessage_REVOKE {
+        // Deleted message
+        event.Type = "message_revoked"
+        event.OriginalMessageID = protocolMsg.GetKey().GetId()
+    } else if reaction := content.GetReactionMessage(); reaction != nil {
+        // Reaction, an empty emoji means the reaction was removed
+        event.Type = "reaction_message"
+        event.Reaction = &WebhookReaction{
+            Emoji:           reaction.GetText(),
+            Removed:         reaction.GetText() == "",
+            TargetMessageID: reaction.GetKey().GetId(),
+            TargetFromMe:    reaction.GetKey().GetFromMe(),
+        }
+    } else if text := content.GetConversation(); text != "" {
         // Text message
-        isSupported = true
-        jsonData, _ = utils.AppendToJSON(jsonData, "type", "text_message")
-        jsonData, _ = utils.AppendToJSON(jsonData, "message", text)
-        jsonData, _ = utils.AppendToJSON(jsonData, "message_id", messageID)
-    } else if extendedText := evt.Message.GetExtendedTextMessage(); extendedText != nil {
+        event.Type = "text_message"
+        event.Text = text
+    } else if extendedText := content.GetExtendedTextMessage(); extendedText != nil {
         // Extended text message
         if evt.Info.Type == "text" {
-            isSupported = true
-            message := extendedText.GetText()
             if !statusMessage {
-                jsonData, _ = utils.AppendToJSON(jsonData, "type", "text_message")
+                event.Type = "text_message"
             } else {
-                jsonData, _ = utils.AppendToJSON(jsonData, "type", "status_message")
+                event.Type = "status_message"
             }
-            jsonData, _ = utils.AppendToJSON(jsonData, "message", message)
-            jsonData, _ = utils.AppendToJSON(jsonData, "message_id", messageID)
+            event.Text = extendedText.GetText()
         } else if evt.Info.Type == "media" {
             // Link message
             if extendedText.GetCanonicalUrl() != "" {
-                isSupported = true
-                message := extendedText.GetText()
-                matchedText := extendedText.GetMatchedText()
-                canonicalURL := extendedText.GetCanonicalUrl()
-                description := extendedText.GetDescription()
-                title := extendedText.GetTitle()
                 linkPreviewThumbnail := extendedText.GetJpegThumbnail()
                 if len(linkPreviewThumbnail) == 0 {
                     c.Logger.Errorf("Failed to save link preview thumbnail: User cancelled it")
@@ -494,101 +603,148 @@ func (c *Client) ParseReceivedMessage(evt *events.Message, wg *sync.WaitGroup) {
                     return
                 }
                 c.Logger.Infof("Saved link preview thumbnail in message to %s", path)
-                jsonData, _ = utils.AppendToJSON(jsonData, "path", path)
                 if !statusMessage {
-                    jsonData, _ = utils.AppendToJSON(jsonData, "type", "link_message")
+                    event.Type = "link_message"
                 } else {
-                    jsonData, _ = utils.AppendToJSON(jsonData, "type", "status_message")
+                    event.Type = "status_message"
+                }
+                event.Text = extendedText.GetText()
+                event.Link = &WebhookLink{
+                    MatchedText:   extendedText.GetMatchedText(),
+                    CanonicalURL:  extendedText.GetCanonicalUrl(),
+                    Title:         extendedText.GetTitle(),
+                    Description:   extendedText.GetDescription(),
+                    ThumbnailPath: path,
                 }
-                jsonData, _ = utils.AppendToJSON(jsonData, "message", message)
-                jsonData, _ = utils.AppendToJSON(jsonData, "link_matched_text", matchedText)
-                jsonData, _ = utils.AppendToJSON(jsonData, "link_canonical_url", canonicalURL)
-                jsonData, _ = utils.AppendToJSON(jsonData, "link_description", description)
-                jsonData, _ = utils.AppendToJSON(jsonData, "link_title", title)
-                jsonData, _ = utils.AppendToJSON(jsonData, "message_id", messageID)
             }
         }
-    } else if buttonResp := evt.Message.GetButtonsResponseMessage(); buttonResp != nil {
+    } else if buttonResp := content.GetButtonsResponseMessage(); buttonResp != nil {
         // Button response message
-        isSupported = true
-        originMessageID := buttonResp.GetContextInfo().GetStanzaId()
-        buttonSelected := buttonResp.GetSelectedDisplayText()
-        buttonTitle := buttonResp.GetContextInfo().GetQuotedMessage().GetButtonsMessage().GetText()
-        buttonBody := buttonResp.GetContextInfo().GetQuotedMessage().GetButtonsMessage().GetContentText()
-        buttonFooter := buttonResp.GetContextInfo().GetQuotedMessage().GetButtonsMessage().GetFooterText()
-
-        jsonData, _ = utils.AppendToJSON(jsonData, "type", "button_response_message")
-        jsonData, _ = utils.AppendToJSON(jsonData, "button_selected_button", buttonSelected)
-        jsonData, _ = utils.AppendToJSON(jsonData, "button_title", buttonTitle)
-        jsonData, _ = utils.AppendToJSON(jsonData, "button_body", buttonBody)
-        jsonData, _ = utils.AppendToJSON(jsonData, "button_footer", buttonFooter)
-        jsonData, _ = utils.AppendToJSON(jsonData, "origin_message_id", originMessageID)
-        jsonData, _ = utils.AppendToJSON(jsonData, "message_id", messageID)
-    } else if listResp := evt.Message.GetListResponseMessage(); listResp != nil {
+        buttons := buttonResp.GetContextInfo().GetQuotedMessage().GetButtonsMessage()
+        event.Type = "button_response_message"
+        event.Button = &WebhookButtonResponse{
+            OriginMessageID: buttonResp.GetContextInfo().GetStanzaId(),
+            Selected:        buttonResp.GetSelectedDisplayText(),
+            Title:           buttons.GetText(),
+            Body:            buttons.GetContentText(),
+            Footer:          buttons.GetFooterText(),
+        }
+    } else if listResp := content.GetListResponseMessage(); listResp != nil {
         // List response message
-        isSupported = true
-        originMessageID := listResp.GetContextInfo().GetStanzaId()
-        listSelectedTitle := listResp.GetTitle()
-        listSelectedDescription := listResp.GetDescription()
-        listTitle := listResp.GetContextInfo().GetQuotedMessage().GetListMessage().GetTitle()
-        listBody := listResp.GetContextInfo().GetQuotedMessage().GetListMessage().GetDescription()
-        listFooter := listResp.GetContextInfo().GetQuotedMessage().GetListMessage().GetFooterText()
-        listButtonText := listResp.GetContextInfo().GetQuotedMessage().GetListMessage().GetButtonText()
-        listHeader := listResp.GetContextInfo().GetQuotedMessage().GetListMessage().GetSections()[0].GetTitle()
-
-        jsonData, _ = utils.AppendToJSON(jsonData, "type", "list_response_message")
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_selected_title", listSelectedTitle)
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_selected_description", listSelectedDescription)
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_title", listTitle)
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_body", listBody)
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_footer", listFooter)
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_button_text", listButtonText)
-        jsonData, _ = utils.AppendToJSON(jsonData, "list_header", listHeader)
-        jsonData, _ = utils.AppendToJSON(jsonData, "message_id", messageID)
-        jsonData, _ = utils.AppendToJSON(jsonData, "origin_message_id", originMessageID)
-    } else if pollUpdate := evt.Message.GetPollUpdateMessage(); pollUpdate != nil {
-        // Poll update message
-        isSupported = true
-        messageID = pollUpdate.GetPollCreationMessageKey().GetId()
-        decrypted, err := c.WAClient.DecryptPollVote(evt)
+        list := listResp.GetContextInfo().GetQuotedMessage().GetListMessage()
+        event.Type = "list_response_message"
+        event.List = &WebhookListResponse{
+            OriginMessageID:     listResp.GetContextInfo().GetStanzaId(),
+            SelectedRowID:       listResp.GetSingleSelectReply().GetSelectedRowId(),
+            SelectedTitle:       listResp.GetTitle(),
+            SelectedDescription: listResp.GetDescription(),
+            Title:               list.GetTitle(),
+            Body:                list.GetDescription(),
+            Footer:              list.GetFooterText(),
+            ButtonText:          list.GetButtonText(),
+        }
+        if sections := list.GetSections(); len(sections) > 0 {
+            event.List.Header = sections[0].GetTitle()
+        }
+    } else if content.GetPollUpdateMessage() != nil {
+        // Poll update message, already recorded by EventHandler
+        if pollVote == nil {
+            return
+        }
+        event.Type = "poll_response_message"
+        event.Poll = pollVote
+    } else if location := content.GetLocationMessage(); location != nil {
+        // Location message
+        event.Type = "location_message"
+        event.Location = &WebhookLocation{
+            Latitude:  location.GetDegreesLatitude(),
+            Longitude: location.GetDegreesLongitude(),
+            Accuracy:  location.GetAccuracyInMeters(),
+            Name:      location.GetName(),
+            Address:   location.GetAddress(),
+            URL:       location.GetUrl(),
+        }
+    } else if liveLocation := content.GetLiveLocationMessage(); liveLocation != nil {
+        // Live location message or update
+        event.Type = "live_location_message"
+        event.Location = &WebhookLocation{
+            Latitude:       liveLocation.GetDegreesLatitude(),
+            Longitude:      liveLocation.GetDegreesLongitude(),
+            Accuracy:       liveLocation.GetAccuracyInMeters(),
+            IsLive:         true,
+            Speed:          liveLocation.GetSpeedInMps(),
+            Caption:        liveLocation.GetCaption(),
+            SequenceNumber: liveLocation.GetSequenceNumber(),
+            TimeOffset:     liveLocation.GetTimeOffset(),
+        }
+    } else if contact := content.GetContactMessage(); contact != nil {
+        // Shared contact
+        event.Type = "contact_message"
+        event.Contacts = &WebhookContacts{
+            DisplayName: contact.GetDisplayName(),
+            Contacts:    []VCard{parseVCard(contact.GetVcard())},
+        }
+    } else if contactsArray := content.GetContactsArrayMessage(); contactsArray != nil {
+        // Several shared contacts
+        contacts := make([]VCard, 0, len(contactsArray.GetContacts()))
+        for _, contact := range contactsArray.GetContacts() {
+            contacts = append(contacts, parseVCard(contact.GetVcard()))
+        }
+        event.Type = "contact_message"
+        event.Contacts = &WebhookContacts{DisplayName: contactsArray.GetDisplayName(), Contacts: contacts}
+    } else if media, mediaType, caption := getDownloadableMedia(content); c.Config.SaveMedia && media != nil {
+        // Media message (image, video, audio, voice note, document, sticker)
+        data, err := c.WAClient.Download(media)
         if err != nil {
-            c.Logger.Errorf("Failed to decrypt vote: %v", err)
+            c.Logger.Errorf("Failed to download %s: %v", mediaType, err)
             return
         }
-
-        questionData, err := os.ReadFile(filepath.Join(c.CurrentDir, ".tmp", "poll_question_"+messageID))
+        extension := "bin"
+        if match := utils.MatchMimeType(data); match != nil && len(match.Extensions) > 0 {
+            extension = strings.TrimPrefix(match.Extensions[0], ".")
+        }
+        os.MkdirAll(filepath.Join(c.CurrentDir, "media", mediaType), os.ModePerm)
+        path = filepath.Join(c.CurrentDir, "media", mediaType, fmt.Sprintf("%s.%s", evt.Info.ID, extension))
+        err = os.WriteFile(path, data, 0644)
         if err != nil {
-            c.Logger.Errorf("Failed to read question data: %v", err)
+            c.Logger.Errorf("Failed to save %s: %v", mediaType, err)
             return
         }
-
-        question := string(questionData)
-
-        selectedOptions := make([]interface{}, len(decrypted.SelectedOptions))
-        for i, selectedOption := range decrypted.SelectedOptions {
-            optionData, err := os.ReadFile(filepath.Join(c.CurrentDir, ".tmp", "poll_option_"+strings.ToLower(fmt.Sprintf("%X", selectedOption))))
-            if err != nil {
-                c.Logger.Errorf("Failed to read option data: %v", err)
-                return
-            }
-            selectedOptions[i] = string(optionData)
+        c.Logger.Infof("Saved %s in message to %s", mediaType, path)
+        err = c.History.SetMediaPath(evt.Info.Chat, evt.Info.ID, path)
+        if err != nil {
+            c.Logger.Warnf("Failed to record media path of %s: %v", evt.Info.ID, err)
+        }
+        if event.IsViewOnce {
+            event.Type = "view_once_" + mediaType + "_message"
+        } else if !statusMessage {
+            event.Type = mediaType + "_message"
+        } else {
+            event.Type = "status_message"
+        }
+        event.Media = &WebhookMedia{
+            Kind:       mediaType,
+            Path:       path,
+            MimeType:   media.GetMimetype(),
+            Caption:    caption,
+            FileLength: uint64(len(data)),
+            SHA256:     fmt.Sprintf("%x", sha256.Sum256(data)),
+            IsAnimated: content.GetStickerMessage().GetIsAnimated(),
+        }
+    } else if sticker := content.GetStickerMessage(); sticker != nil {
+        // Sticker message when media isn't saved
+        event.Type = "sticker_message"
+        event.Media = &WebhookMedia{
+            Kind:       "sticker",
+            MimeType:   sticker.GetMimetype(),
+            FileLength: sticker.GetFileLength(),
+            SHA256:     fmt.Sprintf("%x", sticker.GetFileSha256()),
+            IsAnimated: sticker.GetIsAnimated(),
         }
-
-        jsonData, _ = utils.AppendToJSON(jsonData, "type", "poll_response_message")
-        jsonData, _ = utils.AppendToJSON(jsonData, "poll_question", question)
-        jsonData, _ = utils.AppendToJSON(jsonData, "poll_selected_options", selectedOptions)
-        jsonData, _ = utils.AppendToJSON(jsonData, "message_id", messageID)
-    } else if c.Config.SaveMedia {
-        // Handle media messages (e.g., images, videos, audio, etc.)
-        // Implement handling similar to the original code, downloading media, saving files, etc.
-        // Due to the complexity, please refer to the original `parseReceivedMessage` function for detailed implementation.
     }
 
-    if isSupported {
-        c.Logger.Infof("%s", jsonData)
-        // Send HTTP POST request
-        httpPath := "/message"
-        go c.sendHttpPost(jsonData, httpPath)
+    if event.Type != "" {
+        go c.sendWebhookEvent(event)
     }
     if c.Config.AutoDelete {
         go func() {
@@ -600,26 +756,68 @@ func (c *Client) ParseReceivedMessage(evt *events.Message, wg *sync.WaitGroup) {
     }
 }
 
-func (c *Client) sendHttpPost(jsonData string, path string) {
-    client := &http.Client{
-        Timeout: 1 * time.Second,
-    }
+// mediaMessage is implemented by every downloadable media message that carries a mimetype.
+type mediaMessage interface {
+    whatsmeow.DownloadableMessage
+    GetMimetype() string
+}
 
-    jsonBody := []byte(jsonData)
-    bodyReader := bytes.NewReader(jsonBody)
+// unwrapMessage returns the content inside the device sent, ephemeral, view once,
+// document with caption and edit envelopes of msg, and whether it was view once or ephemeral.
+func unwrapMessage(msg *waProto.Message) (*waProto.Message, bool, bool) {
+    viewOnce := false
+    ephemeral := false
+    for {
+        switch {
+        case msg.GetDeviceSentMessage().GetMessage() != nil:
+            msg = msg.GetDeviceSentMessage().GetMessage()
+        case msg.GetEphemeralMessage().GetMessage() != nil:
+            ephemeral = true
+            msg = msg.GetEphemeralMessage().GetMessage()
+        case msg.GetViewOnceMessage().GetMessage() != nil:
+            viewOnce = true
+            msg = msg.GetViewOnceMessage().GetMessage()
+        case msg.GetViewOnceMessageV2().GetMessage() != nil:
+            viewOnce = true
+            msg = msg.GetViewOnceMessageV2().GetMessage()
+        case msg.GetViewOnceMessageV2Extension().GetMessage() != nil:
+            viewOnce = true
+            msg = msg.GetViewOnceMessageV2Extension().GetMessage()
+        case msg.GetDocumentWithCaptionMessage().GetMessage() != nil:
+            msg = msg.GetDocumentWithCaptionMessage().GetMessage()
+        case msg.GetEditedMessage().GetMessage() != nil:
+            msg = msg.GetEditedMessage().GetMessage()
+        default:
+            return msg, viewOnce, ephemeral
+        }
+    }
+}
 
-    requestURL := fmt.Sprintf("http://localhost:%d%s", c.Config.HTTPPort, path)
-    req, err := http.NewRequest(http.MethodPost, requestURL, bodyReader)
-    if err != nil {
-        c.Logger.Errorf("Failed to create HTTP request: %v", err)
-        return
+// getDownloadableMedia returns the downloadable part of a media message along with
+// its media type (used for the webhook type and the media/<type> directory) and caption.
+func getDownloadableMedia(msg *waProto.Message) (mediaMessage, string, string) {
+    if img := msg.GetImageMessage(); img != nil {
+        return img, "image", img.GetCaption()
+    } else if video := msg.GetVideoMessage(); video != nil {
+        return video, "video", video.GetCaption()
+    } else if audio := msg.GetAudioMessage(); audio != nil {
+        return audio, "audio", ""
+    } else if document := msg.GetDocumentMessage(); document != nil {
+        return document, "document", document.GetCaption()
+    } else if sticker := msg.GetStickerMessage(); sticker != nil {
+        return sticker, "sticker", ""
     }
-    resp, err := client.Do(req)
-    if err != nil {
-        c.Logger.Errorf("Failed to send HTTP POST request: %v", err)
-        return
+    return nil, "", ""
+}
+
+func (c *Client) sendHttpPost(jsonData string) {
+    for _, target := range c.webhookTargets() {
+        go c.deliverWebhook(&WebhookDelivery{
+            URL:     target,
+            Body:    jsonData,
+            Created: time.Now(),
+        })
     }
-    defer resp.Body.Close()
 }
 
 func (c *Client) SendMessage(recipientJID string, message string) error {
@@ -629,7 +827,7 @@ func (c *Client) SendMessage(recipientJID string, message string) error {
         return fmt.Errorf("invalid JID")
     }
     msg := &waE2E.Message{Conversation: proto.String(message)}
-    resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+    resp, err := c.sendMessage(recipient, msg)
     if err != nil {
         c.Logger.Errorf("Error sending message: %v", err)
         return err
@@ -638,27 +836,69 @@ func (c *Client) SendMessage(recipientJID string, message string) error {
     return nil
 }
 
-func (c *Client) HandleCommand(cmd string, args []string) {
-	if handler, exists := c.commandHandlers[cmd]; exists {
-		err := handler(args)
-		if err != nil {
-			c.Logger.Errorf("Error executing command %s: %v", cmd, err)
-		}
-	} else {
+// HandleCommand runs a registered command handler. Handlers log their own failures,
+// so the returned error is only meant for callers that report it elsewhere.
+func (c *Client) HandleCommand(cmd string, args []string) (*CommandResult, error) {
+	handler, exists := c.commandHandlers[cmd]
+	if !exists {
 		c.Logger.Warnf("Unknown command: %s", cmd)
+		return nil, fmt.Errorf("unknown command: %s", cmd)
 	}
+	return handler(args)
+}
+
+// failf logs a command failure and returns it as an error, so that it also reaches HTTP callers.
+func (c *Client) failf(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	c.Logger.Errorf("%v", err)
+	return err
+}
+
+// sendResult turns a whatsmeow send response into a command result.
+func sendResult(resp whatsmeow.SendResponse) *CommandResult {
+	return &CommandResult{MessageID: resp.ID, Timestamp: resp.Timestamp}
+}
+
+// writeJSON writes v as the JSON body of an HTTP response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// newCommandResponse builds the JSON response for a finished command.
+func newCommandResponse(result *CommandResult, err error) CommandResponse {
+	if err != nil {
+		return CommandResponse{OK: false, Error: err.Error()}
+	}
+	resp := CommandResponse{OK: true}
+	if result != nil {
+		resp.MessageID = result.MessageID
+		if !result.Timestamp.IsZero() {
+			resp.Timestamp = result.Timestamp.Unix()
+		}
+		resp.Data = result.Data
+	}
+	return resp
 }
 
 func (c *Client) StartServer() {
 	if !c.ServerRunning {
+		addr, err := c.listenAddress()
+		if err != nil {
+			c.Logger.Errorf("Failed to start HTTP server: %v", err)
+			return
+		}
 		mux := http.NewServeMux()
 		mux.HandleFunc("/", c.HandleHTTPRequest)
+		mux.HandleFunc("/history", c.HandleHistoryRequest)
+		mux.HandleFunc("/search", c.HandleSearchRequest)
+		mux.HandleFunc("/send/media", c.HandleSendMediaRequest)
 		c.HTTPServer = &http.Server{
-			Addr:    "localhost:" + fmt.Sprintf("%d", c.Config.HTTPPort),
+			Addr:    addr,
 			Handler: mux,
 		}
 		c.ServerRunning = true
-		c.Logger.Infof("HTTP server started on port %d", c.Config.HTTPPort)
+		c.Logger.Infof("HTTP server started on %s", addr)
 		go func() {
 			err := c.HTTPServer.ListenAndServe()
 			if err != nil && err != http.ErrServerClosed {
@@ -700,30 +940,60 @@ func (c *Client) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	case "POST":
+		if !c.authorized(r) {
+			c.Logger.Warnf("Rejected unauthorized POST request from %s", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// With ?wait=1 (or "sync": true in the first object of the body) every command is
+		// run before responding and its outcome is returned as JSON instead of the plain
+		// "command received". The format is decided once, for the whole response.
+		wait := r.URL.Query().Get("wait")
+		syncMode := wait == "1" || wait == "true"
+		enc := json.NewEncoder(w)
 		dec := json.NewDecoder(r.Body)
-		for {
+		for first := true; ; first = false {
 			argsData := struct {
 				Args []string `json:"args"`
+				Sync bool     `json:"sync"`
 			}{}
 
-			if err := dec.Decode(&argsData); err == io.EOF {
+			err := dec.Decode(&argsData)
+			if first {
+				syncMode = syncMode || argsData.Sync
+				if syncMode {
+					w.Header().Set("Content-Type", "application/json")
+				}
+			}
+			if err == io.EOF {
 				break
 			} else if err != nil {
 				c.Logger.Errorf("Error decoding JSON: %v", err)
+				if syncMode {
+					enc.Encode(newCommandResponse(nil, fmt.Errorf("invalid JSON: %w", err)))
+				}
 				return
 			}
 
 			args := argsData.Args
 
 			if len(args) < 1 {
-				fmt.Fprintf(w, "command received")
+				if syncMode {
+					enc.Encode(newCommandResponse(nil, fmt.Errorf("no command given")))
+				} else {
+					fmt.Fprintf(w, "command received")
+				}
 				return
 			}
 
 			cmd := strings.ToLower(args[0])
 
 			if cmd == "stop" {
-				fmt.Fprintf(w, "exiting")
+				if syncMode {
+					enc.Encode(CommandResponse{OK: true, Data: "exiting"})
+				} else {
+					fmt.Fprintf(w, "exiting")
+				}
 				go func() {
 					time.Sleep(1 * time.Second)
 					c.StopServer()
@@ -733,7 +1003,11 @@ func (c *Client) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 				}()
 				return
 			} else if cmd == "restart" {
-				fmt.Fprintf(w, "restarting")
+				if syncMode {
+					enc.Encode(CommandResponse{OK: true, Data: "restarting"})
+				} else {
+					fmt.Fprintf(w, "restarting")
+				}
 				go func() {
 					time.Sleep(1 * time.Second)
 					c.StopServer()
@@ -750,6 +1024,11 @@ func (c *Client) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			if syncMode {
+				enc.Encode(newCommandResponse(c.HandleCommand(cmd, args[1:])))
+				continue
+			}
+
 			fmt.Fprintf(w, "command received")
 			if c.Config.Mode == "both" || c.Config.Mode == "send" {
 				go c.HandleCommand(cmd, args[1:])
@@ -770,7 +1049,7 @@ func (c *Client) SendMessage(recipientJID string, message string) error {
 		return fmt.Errorf("invalid JID")
 	}
 	msg := &waProto.Message{Conversation: proto.String(message)}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
 		c.Logger.Errorf("Error sending message: %v", err)
 		return err
@@ -3,212 +3,296 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mdp/qrterminal/v3"
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/appstate"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	"wahelper/utils"
 )
 
-func (c *Client) handlePairPhoneCommand(args []string) error {
+const (
+	// pairPhoneMaxAttempts is how many linking codes are requested before giving up.
+	pairPhoneMaxAttempts = 3
+	// pairClientDisplayName is shown in the "Linked devices" list of the phone.
+	pairClientDisplayName = "Chrome (Linux)"
+)
+
+// startPairing restarts the connection with a QR channel attached, which whatsmeow
+// requires before either a QR code or a phone linking code can be requested.
+func (c *Client) startPairing(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error) {
+	c.WAClient.Disconnect()
+	qrChan, err := c.WAClient.GetQRChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Infof("Connecting to WhatsApp...")
+	err = c.WAClient.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return qrChan, nil
+}
+
+func (c *Client) handlePairPhoneCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: pair-phone <number>")
+	}
 	if c.WAClient.IsLoggedIn() {
 		c.Logger.Infof("Already logged in")
-		return nil
+		return nil, nil
+	}
+	phone := strings.TrimPrefix(args[0], "+")
+	if _, err := strconv.ParseUint(phone, 10, 64); err != nil {
+		return nil, c.failf("Invalid phone number: %s (use \"Country Code\" + \"Phone Number\", e.g. 919876543210)", args[0])
 	}
 
-	qrChan, cancel := c.WAClient.GetQRChannel(context.Background())
-	defer cancel()
+	for attempt := 1; attempt <= pairPhoneMaxAttempts; attempt++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		qrChan, err := c.startPairing(ctx)
+		if err != nil {
+			cancel()
+			return nil, c.failf("Failed to start pairing: %v", err)
+		}
 
-	c.Logger.Infof("Connecting to WhatsApp...")
-	err := c.WAClient.Connect()
+		codeRequested := false
+		expired := false
+		for evt := range qrChan {
+			switch evt.Event {
+			case "code":
+				// The QR channel keeps rotating codes while the linking code is valid,
+				// so only request a linking code once per connection.
+				if codeRequested {
+					continue
+				}
+				codeRequested = true
+				linkingCode, err := c.WAClient.PairPhone(phone, true, whatsmeow.PairClientChrome, pairClientDisplayName)
+				if err != nil {
+					cancel()
+					return nil, c.failf("Failed to request pairing code: %v", err)
+				}
+				fmt.Printf("Pairing code: %s\n", linkingCode)
+				c.Logger.Infof("On your phone open WhatsApp > Linked devices > Link a device > Link with phone number instead, and enter the code above")
+			case "success":
+				cancel()
+				c.Logger.Infof("Successfully paired")
+				return nil, nil
+			case "timeout":
+				expired = true
+			default:
+				cancel()
+				if evt.Error != nil {
+					return nil, c.failf("Pairing failed (%s): %v", evt.Event, evt.Error)
+				}
+				return nil, c.failf("Pairing failed: %s", evt.Event)
+			}
+		}
+		cancel()
+		if !expired {
+			return nil, c.failf("Pairing was interrupted")
+		}
+		if attempt < pairPhoneMaxAttempts {
+			c.Logger.Warnf("Pairing code expired, requesting a new one (attempt %d of %d)", attempt+1, pairPhoneMaxAttempts)
+		}
+	}
+
+	return nil, c.failf("Pairing code expired, run pair-phone again to get a new one")
+}
+
+func (c *Client) handlePairQRCommand(args []string) (*CommandResult, error) {
+	if c.WAClient.IsLoggedIn() {
+		c.Logger.Infof("Already logged in")
+		return nil, nil
+	}
+	pngPath := ""
+	if len(args) > 0 {
+		pngPath = args[0]
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	qrChan, err := c.startPairing(ctx)
 	if err != nil {
-		c.Logger.Errorf("Failed to connect: %v", err)
-		return err
+		return nil, c.failf("Failed to start pairing: %v", err)
 	}
 
 	c.Logger.Infof("Please scan the QR code to login")
 	for evt := range qrChan {
-		if evt.Event == "code" {
-			// Print QR code to terminal
-			fmt.Printf("QR Code: %s\n", evt.Code)
-			// You can use a library like "github.com/mdp/qrterminal/v3" to display the QR code in the terminal
-			// qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-		} else {
-			c.Logger.Infof("Login event: %s", evt.Event)
+		switch evt.Event {
+		case "code":
+			if pngPath != "" {
+				err = qrcode.WriteFile(evt.Code, qrcode.Medium, 512, pngPath)
+				if err != nil {
+					return nil, c.failf("Failed to write QR code to %s: %v", pngPath, err)
+				}
+				c.Logger.Infof("QR code written to %s (expires in %s)", pngPath, evt.Timeout)
+			} else {
+				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
+				c.Logger.Infof("QR code expires in %s", evt.Timeout)
+			}
+		case "success":
+			c.Logger.Infof("Successfully paired")
+			return nil, nil
+		case "timeout":
+			return nil, c.failf("QR code expired, run pair-qr again to get a new one")
+		default:
+			if evt.Error != nil {
+				return nil, c.failf("Pairing failed (%s): %v", evt.Event, evt.Error)
+			}
+			return nil, c.failf("Pairing failed: %s", evt.Event)
 		}
 	}
-
-	return nil
+	return nil, nil
 }
 
-func (c *Client) handleLogoutCommand(args []string) error {
+func (c *Client) handleLogoutCommand(args []string) (*CommandResult, error) {
 	err := c.WAClient.Logout()
 	if err != nil {
-		c.Logger.Errorf("Error logging out: %v", err)
-	} else {
-		c.Logger.Infof("Successfully logged out")
+		return nil, c.failf("Error logging out: %v", err)
 	}
-	return err
+	c.Logger.Infof("Successfully logged out")
+	return nil, nil
 }
 
-func (c *Client) handleSetPushNameCommand(args []string) error {
+func (c *Client) handleSetPushNameCommand(args []string) (*CommandResult, error) {
 	if len(args) == 0 {
-		c.Logger.Errorf("Usage: setpushname <name>")
-		return nil
+		return nil, c.failf("Usage: setpushname <name>")
 	}
 	pushName := strings.Join(args, " ")
 	err := c.WAClient.SendAppState(appstate.BuildSettingPushName(pushName))
 	if err != nil {
-		c.Logger.Errorf("Error setting push name: %v", err)
-	} else {
-		c.Logger.Infof("Push name updated")
+		return nil, c.failf("Error setting push name: %v", err)
 	}
-	return err
+	c.Logger.Infof("Push name updated")
+	return nil, nil
 }
 
-func (c *Client) handleSetStatusCommand(args []string) error {
+func (c *Client) handleSetStatusCommand(args []string) (*CommandResult, error) {
 	if len(args) == 0 {
-		c.Logger.Errorf("Usage: setstatus <message>")
-		return nil
+		return nil, c.failf("Usage: setstatus <message>")
 	}
 	statusMessage := strings.Join(args, " ")
 	err := c.WAClient.SetStatusMessage(statusMessage)
 	if err != nil {
-		c.Logger.Errorf("Error setting status message: %v", err)
-	} else {
-		c.Logger.Infof("Status updated")
+		return nil, c.failf("Error setting status message: %v", err)
 	}
-	return err
+	c.Logger.Infof("Status updated")
+	return nil, nil
 }
 
-func (c *Client) handlePrivacySettingsCommand(args []string) error {
+func (c *Client) handlePrivacySettingsCommand(args []string) (*CommandResult, error) {
 	resp, err := c.WAClient.TryFetchPrivacySettings(false)
 	if err != nil {
-		c.Logger.Errorf("Error fetching privacy settings: %v", err)
-	} else {
-		c.Logger.Infof("Privacy settings: %+v", resp)
+		return nil, c.failf("Error fetching privacy settings: %v", err)
 	}
-	return err
+	c.Logger.Infof("Privacy settings: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleSetPrivacySettingCommand(args []string) error {
+func (c *Client) handleSetPrivacySettingCommand(args []string) (*CommandResult, error) {
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: setprivacysetting <setting> <value>")
-		return nil
+		return nil, c.failf("Usage: setprivacysetting <setting> <value>")
 	}
 	setting := types.PrivacySettingType(args[0])
 	value := types.PrivacySetting(args[1])
 	resp, err := c.WAClient.SetPrivacySetting(setting, value)
 	if err != nil {
-		c.Logger.Errorf("Error setting privacy setting: %v", err)
-	} else {
-		c.Logger.Infof("Privacy setting updated: %+v", resp)
+		return nil, c.failf("Error setting privacy setting: %v", err)
 	}
-	return err
+	c.Logger.Infof("Privacy setting updated: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleGetStatusPrivacyCommand(args []string) error {
+func (c *Client) handleGetStatusPrivacyCommand(args []string) (*CommandResult, error) {
 	resp, err := c.WAClient.GetStatusPrivacy()
 	if err != nil {
-		c.Logger.Errorf("Error getting status privacy: %v", err)
-	} else {
-		c.Logger.Infof("Status privacy: %+v", resp)
+		return nil, c.failf("Error getting status privacy: %v", err)
 	}
-	return err
+	c.Logger.Infof("Status privacy: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleSetDisappearTimerCommand(args []string) error {
+func (c *Client) handleSetDisappearTimerCommand(args []string) (*CommandResult, error) {
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: setdisappeartimer <jid> <days>")
-		return nil
+		return nil, c.failf("Usage: setdisappeartimer <jid> <days>")
 	}
 	days, err := strconv.Atoi(args[1])
 	if err != nil {
-		c.Logger.Errorf("Invalid duration: %v", err)
-		return nil
+		return nil, c.failf("Invalid duration: %v", err)
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		c.Logger.Errorf("Invalid JID: %s", args[0])
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	duration := time.Duration(days) * 24 * time.Hour
 	err = c.WAClient.SetDisappearingTimer(recipient, duration)
 	if err != nil {
-		c.Logger.Errorf("Failed to set disappearing timer: %v", err)
-	} else {
-		c.Logger.Infof("Disappearing timer set for %s to %d days", recipient.String(), days)
+		return nil, c.failf("Failed to set disappearing timer: %v", err)
 	}
-	return err
+	c.Logger.Infof("Disappearing timer set for %s to %d days", recipient.String(), days)
+	return nil, nil
 }
 
-func (c *Client) handleSetDefaultDisappearTimerCommand(args []string) error {
+func (c *Client) handleSetDefaultDisappearTimerCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: setdefaultdisappeartimer <days>")
-		return nil
+		return nil, c.failf("Usage: setdefaultdisappeartimer <days>")
 	}
 	days, err := strconv.Atoi(args[0])
 	if err != nil {
-		c.Logger.Errorf("Invalid duration: %v", err)
-		return nil
+		return nil, c.failf("Invalid duration: %v", err)
 	}
 	duration := time.Duration(days) * 24 * time.Hour
 	err = c.WAClient.SetDefaultDisappearingTimer(duration)
 	if err != nil {
-		c.Logger.Errorf("Failed to set default disappearing timer: %v", err)
-	} else {
-		c.Logger.Infof("Default disappearing timer set to %d days", days)
+		return nil, c.failf("Failed to set default disappearing timer: %v", err)
 	}
-	return err
+	c.Logger.Infof("Default disappearing timer set to %d days", days)
+	return nil, nil
 }
 
-func (c *Client) handleGetBlockListCommand(args []string) error {
+func (c *Client) handleGetBlockListCommand(args []string) (*CommandResult, error) {
 	blocklist, err := c.WAClient.GetBlocklist()
 	if err != nil {
-		c.Logger.Errorf("Failed to get blocked contacts list: %v", err)
-	} else {
-		c.Logger.Infof("Blocklist: %+v", blocklist)
+		return nil, c.failf("Failed to get blocked contacts list: %v", err)
 	}
-	return err
+	c.Logger.Infof("Blocklist: %+v", blocklist)
+	return &CommandResult{Data: blocklist}, nil
 }
 
-func (c *Client) handleBlockCommand(args []string) error {
+func (c *Client) handleBlockCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: block <jid>")
-		return nil
+		return nil, c.failf("Usage: block <jid>")
 	}
 	jid, ok := utils.ParseJID(args[0])
 	if !ok {
-		c.Logger.Errorf("Invalid JID: %s", args[0])
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	resp, err := c.WAClient.UpdateBlocklist(jid, events.BlocklistChangeActionBlock)
 	if err != nil {
-		c.Logger.Errorf("Error updating blocklist: %v", err)
-	} else {
-		c.Logger.Infof("Blocked %s: %+v", jid.String(), resp)
+		return nil, c.failf("Error updating blocklist: %v", err)
 	}
-	return err
+	c.Logger.Infof("Blocked %s: %+v", jid.String(), resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleUnblockCommand(args []string) error {
+func (c *Client) handleUnblockCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: unblock <jid>")
-		return nil
+		return nil, c.failf("Usage: unblock <jid>")
 	}
 	jid, ok := utils.ParseJID(args[0])
 	if !ok {
-		c.Logger.Errorf("Invalid JID: %s", args[0])
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	resp, err := c.WAClient.UpdateBlocklist(jid, events.BlocklistChangeActionUnblock)
 	if err != nil {
-		c.Logger.Errorf("Error updating blocklist: %v", err)
-	} else {
-		c.Logger.Infof("Unblocked %s: %+v", jid.String(), resp)
+		return nil, c.failf("Error updating blocklist: %v", err)
 	}
-	return err
+	c.Logger.Infof("Unblocked %s: %+v", jid.String(), resp)
+	return &CommandResult{Data: resp}, nil
 }
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"wahelper/utils"
+)
+
+const (
+	defaultBulkDelay     = 5 * time.Second
+	defaultBulkJitter    = 5 * time.Second
+	defaultBulkPerMinute = 10
+)
+
+func newJobID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// randomJitter returns a random duration in [0, max).
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
+
+// loadBulkRecipients reads recipients from a group JID, a CSV file or a JSON file.
+func (c *Client) loadBulkRecipients(source string) ([]BulkRecipient, error) {
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".csv":
+		return loadBulkRecipientsCSV(source)
+	case ".json":
+		return loadBulkRecipientsJSON(source)
+	}
+
+	group, ok := utils.ParseJID(source)
+	if !ok || group.Server != types.GroupServer {
+		return nil, fmt.Errorf("recipients must be a group JID (@%s), a .csv or a .json file", types.GroupServer)
+	}
+	info, err := c.getGroupInfo(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group info: %w", err)
+	}
+	var recipients []BulkRecipient
+	for _, participant := range info.Participants {
+		if c.WAClient.Store.ID != nil && participant.JID.User == c.WAClient.Store.ID.User {
+			continue
+		}
+		recipients = append(recipients, BulkRecipient{JID: participant.JID.ToNonAD().String()})
+	}
+	return recipients, nil
+}
+
+func isRecipientColumn(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "jid", "phone", "number":
+		return true
+	}
+	return false
+}
+
+// loadBulkRecipientsCSV reads a CSV file. With a header row containing a jid, phone or
+// number column the other columns become template variables, otherwise the first
+// column is the recipient and the optional second column is {{name}}.
+func loadBulkRecipientsCSV(path string) ([]BulkRecipient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	} else if len(records) == 0 {
+		return nil, nil
+	}
+
+	jidColumn := -1
+	var header []string
+	for i, name := range records[0] {
+		if isRecipientColumn(name) {
+			jidColumn = i
+			header = records[0]
+			records = records[1:]
+			break
+		}
+	}
+
+	var recipients []BulkRecipient
+	for _, record := range records {
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		recipient := BulkRecipient{Vars: make(map[string]string)}
+		if header == nil {
+			recipient.JID = strings.TrimSpace(record[0])
+			if len(record) > 1 {
+				recipient.Vars["name"] = strings.TrimSpace(record[1])
+			}
+		} else {
+			for i, value := range record {
+				if i == jidColumn {
+					recipient.JID = strings.TrimSpace(value)
+				} else if i < len(header) {
+					recipient.Vars[strings.ToLower(strings.TrimSpace(header[i]))] = strings.TrimSpace(value)
+				}
+			}
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// loadBulkRecipientsJSON reads a JSON array of JIDs/phone numbers or of objects with
+// a jid, phone or number key, whose other keys become template variables.
+func loadBulkRecipientsJSON(path string) ([]BulkRecipient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []interface{}
+	// Numbers are kept as written, as phone numbers don't survive a round trip through float64
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var recipients []BulkRecipient
+	for i, entry := range entries {
+		switch value := entry.(type) {
+		case string:
+			recipients = append(recipients, BulkRecipient{JID: value})
+		case json.Number:
+			recipients = append(recipients, BulkRecipient{JID: value.String()})
+		case map[string]interface{}:
+			recipient := BulkRecipient{Vars: make(map[string]string)}
+			for key, field := range value {
+				str := fmt.Sprint(field)
+				if isRecipientColumn(key) {
+					recipient.JID = str
+				} else {
+					recipient.Vars[strings.ToLower(key)] = str
+				}
+			}
+			if recipient.JID == "" {
+				return nil, fmt.Errorf("entry %d in %s has no jid, phone or number", i+1, path)
+			}
+			recipients = append(recipients, recipient)
+		default:
+			return nil, fmt.Errorf("entry %d in %s must be a string or an object", i+1, path)
+		}
+	}
+	return recipients, nil
+}
+
+// sendBulkMessage sends the job's message to a single recipient.
+func (c *Client) sendBulkMessage(spec BulkJobSpec, recipient BulkRecipient) (*CommandResult, error) {
+	jid, ok := utils.ParseJID(recipient.JID)
+	if !ok {
+		return nil, fmt.Errorf("invalid JID: %s", recipient.JID)
+	}
+	values := map[string]string{
+		"jid":   jid.String(),
+		"phone": jid.User,
+	}
+	contact, err := c.WAClient.Store.Contacts.GetContact(jid)
+	if err == nil && contact.Found {
+		values["pushname"] = contact.PushName
+		values["name"] = contact.FullName
+		if values["name"] == "" {
+			values["name"] = contact.PushName
+		}
+	}
+	for key, value := range recipient.Vars {
+		values[key] = value
+	}
+	text := utils.FillTemplate(spec.Text, values)
+
+	if spec.Kind == "text" {
+		return c.handleSendCommand([]string{jid.String(), text})
+	} else if spec.Media == nil {
+		return nil, fmt.Errorf("the media of the job wasn't uploaded")
+	}
+	// The media was uploaded once when the job was created, only the caption changes
+	return c.sendUploadedMedia(jid, spec.Media, text, nil)
+}
+
+// startBulkJob runs a bulk job in the background.
+func (c *Client) startBulkJob(id string) {
+	c.BackgroundJobs.Add(1)
+	go func() {
+		defer c.BackgroundJobs.Done()
+		c.runBulkJob(id)
+	}()
+}
+
+// runBulkJob sends to every pending recipient of a job, honoring the delay, jitter and
+// per-minute cap, and records the outcome of each send.
+func (c *Client) runBulkJob(id string) {
+	c.bulkLock.Lock()
+	if c.bulkRunning[id] {
+		c.bulkLock.Unlock()
+		c.Logger.Warnf("Bulk job %s is already running", id)
+		return
+	}
+	c.bulkRunning[id] = true
+	c.bulkLock.Unlock()
+	defer func() {
+		c.bulkLock.Lock()
+		delete(c.bulkRunning, id)
+		c.bulkLock.Unlock()
+	}()
+
+	job, err := c.Bulk.GetJob(id, BulkStatusPending)
+	if err != nil || job == nil {
+		c.Logger.Errorf("Failed to load bulk job %s: %v", id, err)
+		return
+	}
+	if err = c.Bulk.SetJobStatus(id, BulkStatusRunning); err != nil {
+		c.Logger.Errorf("Failed to update bulk job %s: %v", id, err)
+	}
+	c.Logger.Infof("Bulk job %s: sending to %d recipients", id, len(job.Recipients))
+
+	var recentSends []time.Time
+	for i, recipient := range job.Recipients {
+		if i > 0 {
+			time.Sleep(job.Spec.Delay + randomJitter(job.Spec.Jitter))
+		}
+		if job.Spec.PerMinute > 0 {
+			cutoff := time.Now().Add(-time.Minute)
+			for len(recentSends) > 0 && recentSends[0].Before(cutoff) {
+				recentSends = recentSends[1:]
+			}
+			if len(recentSends) >= job.Spec.PerMinute {
+				time.Sleep(time.Until(recentSends[0].Add(time.Minute)))
+				recentSends = recentSends[1:]
+			}
+		}
+
+		result, err := c.sendBulkMessage(job.Spec, recipient)
+		recentSends = append(recentSends, time.Now())
+		if err != nil {
+			c.Logger.Errorf("Bulk job %s: failed to send to %s: %v", id, recipient.JID, err)
+			err = c.Bulk.SetRecipientStatus(id, recipient.JID, BulkStatusFailed, "", err.Error())
+		} else {
+			c.Logger.Infof("Bulk job %s: sent to %s (%d/%d)", id, recipient.JID, i+1, len(job.Recipients))
+			err = c.Bulk.SetRecipientStatus(id, recipient.JID, BulkStatusSent, result.MessageID, "")
+		}
+		if err != nil {
+			c.Logger.Errorf("Failed to update bulk job %s: %v", id, err)
+		}
+	}
+
+	if err = c.Bulk.SetJobStatus(id, BulkStatusCompleted); err != nil {
+		c.Logger.Errorf("Failed to update bulk job %s: %v", id, err)
+	}
+	c.Logger.Infof("Bulk job %s completed", id)
+}
+
+func (c *Client) handleBulkSendCommand(args []string) (*CommandResult, error) {
+	usage := "Usage: bulksend <group jid|recipients.csv|recipients.json> [--kind text|image|video|audio|voice|document] [--media <path>] [--filename <name>] [--delay 5s] [--jitter 5s] [--per-minute 10] -- <text or caption>"
+	if len(args) < 1 {
+		return nil, c.failf("%s", usage)
+	}
+	spec := BulkJobSpec{
+		Kind:      "text",
+		Delay:     defaultBulkDelay,
+		Jitter:    defaultBulkJitter,
+		PerMinute: defaultBulkPerMinute,
+	}
+	i := 1
+	for ; i < len(args) && args[i] != "--"; i++ {
+		if i+1 >= len(args) {
+			return nil, c.failf("Missing value for %s", args[i])
+		}
+		var err error
+		switch args[i] {
+		case "--kind":
+			spec.Kind = args[i+1]
+		case "--media":
+			spec.MediaPath = args[i+1]
+		case "--filename":
+			spec.FileName = args[i+1]
+		case "--delay":
+			spec.Delay, err = time.ParseDuration(args[i+1])
+		case "--jitter":
+			spec.Jitter, err = time.ParseDuration(args[i+1])
+		case "--per-minute":
+			spec.PerMinute, err = strconv.Atoi(args[i+1])
+		default:
+			return nil, c.failf("Unknown option: %s\n%s", args[i], usage)
+		}
+		if err != nil {
+			return nil, c.failf("Invalid value for %s: %v", args[i], err)
+		}
+		i++
+	}
+	if i < len(args) {
+		spec.Text = strings.Join(args[i+1:], " ")
+	}
+
+	switch spec.Kind {
+	case "text":
+		if spec.Text == "" {
+			return nil, c.failf("Missing text after '--'")
+		}
+	case "image", "video", "audio", "voice", "document":
+		if spec.MediaPath == "" {
+			return nil, c.failf("--media is required for %s jobs", spec.Kind)
+		}
+		if spec.MediaPath == "-" {
+			return nil, c.failf("Bulk jobs can't read media from stdin")
+		}
+	default:
+		return nil, c.failf("Invalid kind: %s. Valid kinds are text, image, video, audio, voice, document", spec.Kind)
+	}
+
+	recipients, err := c.loadBulkRecipients(args[0])
+	if err != nil {
+		return nil, c.failf("Failed to load recipients: %v", err)
+	} else if len(recipients) == 0 {
+		return nil, c.failf("No recipients found in %s", args[0])
+	}
+	if spec.Kind != "text" {
+		media, err := c.loadMedia(spec.MediaPath)
+		if err != nil {
+			return nil, c.failf("Failed to read %s: %v", spec.MediaPath, err)
+		}
+		if spec.FileName != "" {
+			media.FileName = spec.FileName
+		}
+		// Upload once for all recipients, the job keeps the upload for bulkresume
+		spec.Media, err = c.uploadMedia(spec.Kind, media)
+		if err != nil {
+			return nil, c.failf("Failed to upload %s: %v", spec.MediaPath, err)
+		}
+	}
+
+	id := newJobID()
+	err = c.Bulk.CreateJob(id, spec, recipients)
+	if err != nil {
+		return nil, c.failf("Failed to create bulk job: %v", err)
+	}
+	c.Logger.Infof("Created bulk job %s for %d recipients", id, len(recipients))
+	c.startBulkJob(id)
+	return &CommandResult{Data: map[string]interface{}{"job_id": id, "recipients": len(recipients)}}, nil
+}
+
+func (c *Client) handleBulkStatusCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: bulkstatus <job ID>")
+	}
+	job, err := c.Bulk.GetJob(args[0], "")
+	if err != nil {
+		return nil, c.failf("Failed to get bulk job: %v", err)
+	} else if job == nil {
+		return nil, c.failf("Unknown bulk job: %s", args[0])
+	}
+	c.Logger.Infof("Bulk job %s (%s, created %s): %d pending, %d sent, %d failed", job.ID, job.Status, job.Created.Format(time.RFC3339),
+		job.Counts[BulkStatusPending], job.Counts[BulkStatusSent], job.Counts[BulkStatusFailed])
+	for _, recipient := range job.Recipients {
+		if recipient.Error != "" {
+			c.Logger.Infof("* %s: %s (%s)", recipient.JID, recipient.Status, recipient.Error)
+		} else {
+			c.Logger.Infof("* %s: %s %s", recipient.JID, recipient.Status, recipient.MessageID)
+		}
+	}
+	return &CommandResult{Data: job}, nil
+}
+
+func (c *Client) handleBulkResumeCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: bulkresume <job ID> [--retry-failed]")
+	}
+	id := args[0]
+	job, err := c.Bulk.GetJob(id, "")
+	if err != nil {
+		return nil, c.failf("Failed to get bulk job: %v", err)
+	} else if job == nil {
+		return nil, c.failf("Unknown bulk job: %s", id)
+	}
+	if len(args) > 1 && args[1] == "--retry-failed" {
+		for _, recipient := range job.Recipients {
+			if recipient.Status != BulkStatusFailed {
+				continue
+			}
+			err = c.Bulk.SetRecipientStatus(id, recipient.JID, BulkStatusPending, "", "")
+			if err != nil {
+				return nil, c.failf("Failed to reset failed recipients: %v", err)
+			}
+		}
+		job.Counts[BulkStatusPending] += job.Counts[BulkStatusFailed]
+	}
+	if job.Counts[BulkStatusPending] == 0 {
+		c.Logger.Infof("Bulk job %s has no pending recipients", id)
+		return &CommandResult{Data: map[string]interface{}{"job_id": id, "pending": 0}}, nil
+	}
+	c.Logger.Infof("Resuming bulk job %s with %d pending recipients", id, job.Counts[BulkStatusPending])
+	c.startBulkJob(id)
+	return &CommandResult{Data: map[string]interface{}{"job_id": id, "pending": job.Counts[BulkStatusPending]}}, nil
+}
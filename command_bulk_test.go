@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadBulkRecipients(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    []BulkRecipient
+		wantErr string
+	}{
+		{
+			name: "csv without header",
+			file: "list.csv",
+			data: "15551230001,Alice\n\n15551230002\n",
+			want: []BulkRecipient{
+				{JID: "15551230001", Vars: map[string]string{"name": "Alice"}},
+				{JID: "15551230002", Vars: map[string]string{}},
+			},
+		},
+		{
+			name: "csv with header",
+			file: "list.csv",
+			data: "Name, Phone ,City\nAlice,15551230001,Paris\nBob, 15551230002 \n",
+			want: []BulkRecipient{
+				{JID: "15551230001", Vars: map[string]string{"name": "Alice", "city": "Paris"}},
+				{JID: "15551230002", Vars: map[string]string{"name": "Bob"}},
+			},
+		},
+		{
+			name: "empty csv",
+			file: "list.csv",
+			data: "",
+		},
+		{
+			name: "json strings and numbers",
+			file: "list.json",
+			data: `["15551230001@s.whatsapp.net", 15551230002]`,
+			want: []BulkRecipient{
+				{JID: "15551230001@s.whatsapp.net"},
+				{JID: "15551230002"},
+			},
+		},
+		{
+			name: "json objects",
+			file: "list.json",
+			data: `[{"number": 15551230001, "Name": "Alice", "orders": 3}, {"jid": "15551230002"}]`,
+			want: []BulkRecipient{
+				{JID: "15551230001", Vars: map[string]string{"name": "Alice", "orders": "3"}},
+				{JID: "15551230002", Vars: map[string]string{}},
+			},
+		},
+		{
+			name:    "json object without recipient",
+			file:    "list.json",
+			data:    `[{"name": "Alice"}]`,
+			wantErr: "entry 1 in",
+		},
+		{
+			name:    "json of other type",
+			file:    "list.json",
+			data:    `["15551230001", true]`,
+			wantErr: "entry 2 in",
+		},
+		{
+			name:    "invalid json",
+			file:    "list.json",
+			data:    `{"jid": "15551230001"}`,
+			wantErr: "failed to parse",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			load := loadBulkRecipientsCSV
+			if filepath.Ext(path) == ".json" {
+				load = loadBulkRecipientsJSON
+			}
+			got, err := load(path)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want %q", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("recipients = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
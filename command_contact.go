@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+	"wahelper/utils"
+)
+
+// VCard is the part of a vCard that is reported to the webhook.
+type VCard struct {
+	Name         string   `json:"name"`
+	PhoneNumbers []string `json:"phone_numbers"`
+	WhatsAppIDs  []string `json:"whatsapp_ids"`
+}
+
+// splitVCards splits the contents of a .vcf file into single vCards.
+func splitVCards(data string) []string {
+	var cards []string
+	var current []string
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		upper := strings.ToUpper(strings.TrimSpace(line))
+		if upper == "BEGIN:VCARD" {
+			current = nil
+		}
+		current = append(current, line)
+		if upper == "END:VCARD" {
+			cards = append(cards, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	return cards
+}
+
+// parseVCard extracts the name, phone numbers and WhatsApp IDs (waid parameters) of a vCard.
+func parseVCard(card string) VCard {
+	var vcard VCard
+	// Lines starting with whitespace continue the previous line
+	card = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(card)
+	for _, line := range strings.Split(card, "\n") {
+		property, value, found := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !found {
+			continue
+		}
+		params := strings.Split(property, ";")
+		// Apple groups properties as item1.TEL
+		name := strings.ToUpper(params[0])
+		if _, after, grouped := strings.Cut(name, "."); grouped {
+			name = after
+		}
+		switch name {
+		case "FN":
+			vcard.Name = value
+		case "N":
+			if vcard.Name == "" {
+				vcard.Name = strings.TrimSpace(strings.Join(strings.Split(value, ";"), " "))
+			}
+		case "TEL":
+			vcard.PhoneNumbers = append(vcard.PhoneNumbers, value)
+			for _, param := range params[1:] {
+				key, waid, _ := strings.Cut(param, "=")
+				if strings.EqualFold(key, "waid") && waid != "" {
+					vcard.WhatsAppIDs = append(vcard.WhatsAppIDs, waid+"@s.whatsapp.net")
+				}
+			}
+		}
+	}
+	return vcard
+}
+
+// buildVCard generates a vCard for a WhatsApp user.
+func buildVCard(name, phone string) string {
+	return fmt.Sprintf("BEGIN:VCARD\nVERSION:3.0\nFN:%s\nTEL;type=CELL;type=VOICE;waid=%s:+%s\nEND:VCARD", name, phone, phone)
+}
+
+// contactVCards returns the vCards for a .vcf file or a contact JID.
+func (c *Client) contactVCards(source string) ([]string, error) {
+	if strings.HasSuffix(strings.ToLower(source), ".vcf") {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		cards := splitVCards(string(data))
+		if len(cards) == 0 {
+			return nil, fmt.Errorf("no vCards found in %s", source)
+		}
+		return cards, nil
+	}
+	jid, ok := utils.ParseJID(source)
+	if !ok {
+		return nil, fmt.Errorf("invalid JID: %s", source)
+	}
+	name := jid.User
+	contact, err := c.WAClient.Store.Contacts.GetContact(jid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact %s: %w", jid, err)
+	} else if contact.FullName != "" {
+		name = contact.FullName
+	} else if contact.PushName != "" {
+		name = contact.PushName
+	}
+	return []string{buildVCard(name, jid.User)}, nil
+}
+
+func (c *Client) handleSendContactCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	if len(args) < 2 {
+		return nil, c.failf("Usage: sendcontact <jid> <contact jid|file.vcf> [contact jid|file.vcf...] [--reply-to <message ID>]")
+	}
+	recipient, ok := utils.ParseJID(args[0])
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", args[0])
+	}
+
+	var contacts []*waProto.ContactMessage
+	for _, source := range args[1:] {
+		cards, err := c.contactVCards(source)
+		if err != nil {
+			return nil, c.failf("Failed to load contact %s: %v", source, err)
+		}
+		for _, card := range cards {
+			contacts = append(contacts, &waProto.ContactMessage{
+				DisplayName: proto.String(parseVCard(card).Name),
+				Vcard:       proto.String(card),
+			})
+		}
+	}
+
+	var msg *waProto.Message
+	if len(contacts) == 1 {
+		msg = &waProto.Message{ContactMessage: contacts[0]}
+	} else {
+		msg = &waProto.Message{ContactsArrayMessage: &waProto.ContactsArrayMessage{
+			DisplayName: proto.String(fmt.Sprintf("%d contacts", len(contacts))),
+			Contacts:    contacts,
+		}}
+	}
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
+	if err != nil {
+		return nil, c.failf("Error sending contact message: %v", err)
+	}
+	c.Logger.Infof("Contact message with %d contacts sent (server timestamp: %s)", len(contacts), resp.Timestamp)
+	return sendResult(resp), nil
+}
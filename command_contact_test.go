@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVCard(t *testing.T) {
+	tests := []struct {
+		name string
+		card string
+		want VCard
+	}{
+		{
+			name: "whatsapp export",
+			card: "BEGIN:VCARD\nVERSION:3.0\nFN:Alice Example\nTEL;type=CELL;type=VOICE;waid=15551230001:+1 555-123-0001\nEND:VCARD",
+			want: VCard{Name: "Alice Example", PhoneNumbers: []string{"+1 555-123-0001"}, WhatsAppIDs: []string{"15551230001@s.whatsapp.net"}},
+		},
+		{
+			name: "crlf and apple groups",
+			card: "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Example;Bob;;;\r\nitem1.TEL;WAID=15551230002:+15551230002\r\nitem2.TEL:+15551230003\r\nEND:VCARD\r\n",
+			want: VCard{Name: "Example Bob", PhoneNumbers: []string{"+15551230002", "+15551230003"}, WhatsAppIDs: []string{"15551230002@s.whatsapp.net"}},
+		},
+		{
+			name: "fn wins over n",
+			card: "BEGIN:VCARD\nN:Example;Carol;;;\nFN:Carol\nEND:VCARD",
+			want: VCard{Name: "Carol"},
+		},
+		{
+			name: "folded lines",
+			card: "BEGIN:VCARD\nFN:Dave\n  Example\nTEL;waid=155512\n 30004:+15551230004\nEND:VCARD",
+			want: VCard{Name: "Dave Example", PhoneNumbers: []string{"+15551230004"}, WhatsAppIDs: []string{"15551230004@s.whatsapp.net"}},
+		},
+		{
+			name: "empty waid",
+			card: "BEGIN:VCARD\nFN:Eve\nTEL;waid=:+15551230005\nEND:VCARD",
+			want: VCard{Name: "Eve", PhoneNumbers: []string{"+15551230005"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseVCard(test.card); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseVCard() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildVCardRoundTrip(t *testing.T) {
+	want := VCard{Name: "Alice", PhoneNumbers: []string{"+15551230001"}, WhatsAppIDs: []string{"15551230001@s.whatsapp.net"}}
+	if got := parseVCard(buildVCard("Alice", "15551230001")); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVCard(buildVCard()) = %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitVCards(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"single", "BEGIN:VCARD\nFN:A\nEND:VCARD\n", []string{"BEGIN:VCARD\nFN:A\nEND:VCARD"}},
+		{"several with crlf", "BEGIN:VCARD\r\nFN:A\r\nEND:VCARD\r\nBEGIN:VCARD\r\nFN:B\r\nEND:VCARD\r\n", []string{"BEGIN:VCARD\nFN:A\nEND:VCARD", "BEGIN:VCARD\nFN:B\nEND:VCARD"}},
+		{"text between cards", "junk\nbegin:vcard\nFN:A\nend:vcard\nmore junk\n", []string{"begin:vcard\nFN:A\nend:vcard"}},
+		{"unterminated", "BEGIN:VCARD\nFN:A\n", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := splitVCards(test.data); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("splitVCards() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
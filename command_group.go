@@ -8,133 +8,115 @@ import (
 	"wahelper/utils"
 )
 
-func (c *Client) handleGetGroupCommand(args []string) error {
+func (c *Client) handleGetGroupCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getgroup <jid>")
-		return nil
+		return nil, c.failf("Usage: getgroup <jid>")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
 	resp, err := c.WAClient.GetGroupInfo(group)
 	if err != nil {
-		c.Logger.Errorf("Failed to get group info: %v", err)
-	} else {
-		c.Logger.Infof("Group info: %+v", resp)
+		return nil, c.failf("Failed to get group info: %v", err)
 	}
-	return err
+	c.Logger.Infof("Group info: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleSubGroupsCommand(args []string) error {
+func (c *Client) handleSubGroupsCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: subgroups <jid>")
-		return nil
+		return nil, c.failf("Usage: subgroups <jid>")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
 	resp, err := c.WAClient.GetSubGroups(context.Background(), group)
 	if err != nil {
-		c.Logger.Errorf("Failed to get subgroups: %v", err)
-	} else {
-		c.Logger.Infof("Subgroups: %+v", resp)
+		return nil, c.failf("Failed to get subgroups: %v", err)
 	}
-	return err
+	c.Logger.Infof("Subgroups: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleCommunityParticipantsCommand(args []string) error {
+func (c *Client) handleCommunityParticipantsCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: communityparticipants <jid>")
-		return nil
+		return nil, c.failf("Usage: communityparticipants <jid>")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
 	resp, err := c.WAClient.GetCommunityParticipants(context.Background(), group)
 	if err != nil {
-		c.Logger.Errorf("Failed to get community participants: %v", err)
-	} else {
-		c.Logger.Infof("Community participants: %+v", resp)
+		return nil, c.failf("Failed to get community participants: %v", err)
 	}
-	return err
+	c.Logger.Infof("Community participants: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleGetInviteLinkCommand(args []string) error {
+func (c *Client) handleGetInviteLinkCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getinvitelink <jid>")
-		return nil
+		return nil, c.failf("Usage: getinvitelink <jid>")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
 	resp, err := c.WAClient.GetGroupInviteLink(group)
 	if err != nil {
-		c.Logger.Errorf("Failed to get invite link: %v", err)
-	} else {
-		c.Logger.Infof("Invite link: %s", resp)
+		return nil, c.failf("Failed to get invite link: %v", err)
 	}
-	return err
+	c.Logger.Infof("Invite link: %s", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleQueryInviteLinkCommand(args []string) error {
+func (c *Client) handleQueryInviteLinkCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: queryinvitelink <link>")
-		return nil
+		return nil, c.failf("Usage: queryinvitelink <link>")
 	}
 	resp, err := c.WAClient.QueryGroupInviteLink(args[0])
 	if err != nil {
-		c.Logger.Errorf("Failed to query invite link: %v", err)
-	} else {
-		c.Logger.Infof("Invite link info: %+v", resp)
+		return nil, c.failf("Failed to query invite link: %v", err)
 	}
-	return err
+	c.Logger.Infof("Invite link info: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleJoinInviteLinkCommand(args []string) error {
+func (c *Client) handleJoinInviteLinkCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: joininvitelink <link>")
-		return nil
+		return nil, c.failf("Usage: joininvitelink <link>")
 	}
 	resp, err := c.WAClient.JoinGroupWithLink(args[0])
 	if err != nil {
-		c.Logger.Errorf("Failed to join invite link: %v", err)
-	} else {
-		c.Logger.Infof("Join invite link response: %+v", resp)
+		return nil, c.failf("Failed to join invite link: %v", err)
 	}
-	return err
+	c.Logger.Infof("Join invite link response: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleUpdateParticipantCommand(args []string) error {
+func (c *Client) handleUpdateParticipantCommand(args []string) (*CommandResult, error) {
 	if len(args) < 3 {
-		c.Logger.Errorf("Usage: updateparticipant <group_jid> <participant_jid> <action>")
-		return nil
+		return nil, c.failf("Usage: updateparticipant <group_jid> <participant_jid> <action>")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
 	participant, ok := utils.ParseJID(args[1])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[1])
 	}
 	action := strings.ToLower(args[2])
 	var err error
@@ -150,35 +132,30 @@ func (c *Client) handleUpdateParticipantCommand(args []string) error {
 	case "demote":
 		resp, err = c.WAClient.DemoteGroupParticipant(group, participant)
 	default:
-		c.Logger.Errorf("Invalid action: %s. Valid actions are add, remove, promote, demote", action)
-		return nil
+		return nil, c.failf("Invalid action: %s. Valid actions are add, remove, promote, demote", action)
 	}
 
 	if err != nil {
-		c.Logger.Errorf("Failed to update participant: %v", err)
-	} else {
-		c.Logger.Infof("Update participant response: %+v", resp)
+		return nil, c.failf("Failed to update participant: %v", err)
 	}
-	return err
+	c.Logger.Infof("Update participant response: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleGetRequestParticipantCommand(args []string) error {
+func (c *Client) handleGetRequestParticipantCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getrequestparticipant <jid>")
-		return nil
+		return nil, c.failf("Usage: getrequestparticipant <jid>")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
 	resp, err := c.WAClient.GetGroupJoinRequests(context.Background(), group)
 	if err != nil {
-		c.Logger.Errorf("Failed to get request participant: %v", err)
-	} else {
-		c.Logger.Infof("Request participant: %+v", resp)
+		return nil, c.failf("Failed to get request participant: %v", err)
 	}
-	return err
+	c.Logger.Infof("Request participant: %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
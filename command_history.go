@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"wahelper/utils"
+)
+
+const defaultHistoryLimit = 50
+
+// sendMessage sends msg and records it in the local message history and the recent message cache.
+func (c *Client) sendMessage(to types.JID, msg *waProto.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	resp, err := c.WAClient.SendMessage(context.Background(), to, msg, extra...)
+	if err != nil {
+		return resp, err
+	}
+	evt := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:     to,
+				Sender:   *c.WAClient.Store.ID,
+				IsFromMe: true,
+				IsGroup:  to.Server == types.GroupServer,
+			},
+			ID:        resp.ID,
+			Timestamp: resp.Timestamp,
+		},
+		Message: msg,
+	}
+	c.cacheRecentMessage(evt)
+	if err := c.History.SaveMessage(evt); err != nil {
+		c.Logger.Warnf("Failed to record sent message %s: %v", resp.ID, err)
+	}
+	return resp, nil
+}
+
+// recordHistorySync stores the messages of a history sync blob.
+func (c *Client) recordHistorySync(evt *events.HistorySync) {
+	count := 0
+	for _, conv := range evt.Data.GetConversations() {
+		chat, err := types.ParseJID(conv.GetId())
+		if err != nil {
+			c.Logger.Warnf("Skipping history of invalid chat %s: %v", conv.GetId(), err)
+			continue
+		}
+		for _, historyMsg := range conv.GetMessages() {
+			msg, err := c.WAClient.ParseWebMessage(chat, historyMsg.GetMessage())
+			if err != nil {
+				c.Logger.Debugf("Failed to parse history message in %s: %v", chat, err)
+				continue
+			}
+			if err = c.History.SaveMessage(msg); err != nil {
+				c.Logger.Warnf("Failed to record history message %s: %v", msg.Info.ID, err)
+				continue
+			}
+			count++
+		}
+	}
+	c.Logger.Infof("Recorded %d messages from history sync (%s)", count, evt.Data.GetSyncType())
+}
+
+func (c *Client) logStoredMessages(messages []StoredMessage) {
+	for _, msg := range messages {
+		c.Logger.Infof("[%s] %s in %s (%s %s): %s", msg.Timestamp.Format(time.RFC3339), msg.Sender, msg.Chat, msg.Type, msg.ID, msg.Text)
+	}
+}
+
+func (c *Client) handleHistoryCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: history <jid> [--limit N] [--before timestamp]")
+	}
+	chat, ok := utils.ParseJID(args[0])
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", args[0])
+	}
+	limit := defaultHistoryLimit
+	var before time.Time
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--limit":
+			if i+1 >= len(args) {
+				return nil, c.failf("Missing value for --limit")
+			}
+			i++
+			var err error
+			limit, err = strconv.Atoi(args[i])
+			if err != nil || limit <= 0 {
+				return nil, c.failf("Invalid limit: %s", args[i])
+			}
+		case "--before":
+			if i+1 >= len(args) {
+				return nil, c.failf("Missing value for --before")
+			}
+			i++
+			var err error
+			before, err = utils.ParseTimestamp(args[i])
+			if err != nil {
+				return nil, c.failf("Invalid timestamp %s: %v", args[i], err)
+			}
+		default:
+			return nil, c.failf("Unknown argument: %s", args[i])
+		}
+	}
+	messages, err := c.History.GetHistory(chat, limit, before)
+	if err != nil {
+		return nil, c.failf("Failed to get history: %v", err)
+	}
+	c.logStoredMessages(messages)
+	return &CommandResult{Data: messages}, nil
+}
+
+func (c *Client) handleSearchCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: search <text> [--limit N]")
+	}
+	limit := defaultHistoryLimit
+	if len(args) > 2 && args[len(args)-2] == "--limit" {
+		var err error
+		limit, err = strconv.Atoi(args[len(args)-1])
+		if err != nil || limit <= 0 {
+			return nil, c.failf("Invalid limit: %s", args[len(args)-1])
+		}
+		args = args[:len(args)-2]
+	}
+	text := strings.Join(args, " ")
+	if strings.TrimSpace(text) == "" {
+		return nil, c.failf("Usage: search <text> [--limit N]")
+	}
+	messages, err := c.History.Search(text, limit)
+	if err != nil {
+		return nil, c.failf("Failed to search messages: %v", err)
+	}
+	c.logStoredMessages(messages)
+	return &CommandResult{Data: messages}, nil
+}
+
+// HandleHistoryRequest serves GET /history?jid=<jid>&limit=<n>&before=<timestamp>.
+func (c *Client) HandleHistoryRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	} else if !c.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	args := []string{query.Get("jid")}
+	if limit := query.Get("limit"); limit != "" {
+		args = append(args, "--limit", limit)
+	}
+	if before := query.Get("before"); before != "" {
+		args = append(args, "--before", before)
+	}
+	writeJSON(w, newCommandResponse(c.handleHistoryCommand(args)))
+}
+
+// HandleSearchRequest serves GET /search?q=<text>&limit=<n>.
+func (c *Client) HandleSearchRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	} else if !c.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	args := []string{query.Get("q")}
+	if limit := query.Get("limit"); limit != "" {
+		args = append(args, "--limit", limit)
+	}
+	writeJSON(w, newCommandResponse(c.handleSearchCommand(args)))
+}
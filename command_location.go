@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+	"wahelper/utils"
+)
+
+const defaultLiveLocationInterval = time.Minute
+
+// parseCoordinates parses a latitude and longitude in decimal degrees.
+func parseCoordinates(latStr, lonStr string) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("invalid latitude: %s", latStr)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("invalid longitude: %s", lonStr)
+	}
+	return lat, lon, nil
+}
+
+// readCoordinatesFile reads "<lat>,<lon>" from a file that is kept up to date by
+// something else, like a GPS tracker.
+func readCoordinatesFile(path string) (float64, float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	latStr, lonStr, found := strings.Cut(strings.TrimSpace(string(data)), ",")
+	if !found {
+		return 0, 0, fmt.Errorf("expected <lat>,<lon> in %s", path)
+	}
+	return parseCoordinates(latStr, lonStr)
+}
+
+func (c *Client) handleSendLocationCommand(args []string) (*CommandResult, error) {
+	usage := "Usage: sendlocation <jid> <lat> <lon> [name] [address] [--reply-to <message ID>]\n       sendlocation <jid> <lat> <lon> --live <duration> [--interval 1m] [--source <file with lat,lon>] [caption]"
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	var live, interval time.Duration
+	source := ""
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--live", "--interval", "--source":
+			if i+1 >= len(args) {
+				return nil, c.failf("Missing value for %s", args[i])
+			}
+			var err error
+			switch args[i] {
+			case "--live":
+				live, err = time.ParseDuration(args[i+1])
+			case "--interval":
+				interval, err = time.ParseDuration(args[i+1])
+			case "--source":
+				source = args[i+1]
+			}
+			if err != nil {
+				return nil, c.failf("Invalid value for %s: %v", args[i], err)
+			}
+			i++
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) < 3 {
+		return nil, c.failf("%s", usage)
+	}
+	recipient, ok := utils.ParseJID(positional[0])
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", positional[0])
+	}
+	lat, lon, err := parseCoordinates(positional[1], positional[2])
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+
+	if live > 0 {
+		if interval <= 0 {
+			interval = defaultLiveLocationInterval
+		}
+		caption := strings.Join(positional[3:], " ")
+		return c.startLiveLocation(recipient, lat, lon, caption, live, interval, source, opts)
+	}
+
+	location := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(lat),
+		DegreesLongitude: proto.Float64(lon),
+	}
+	if len(positional) > 3 {
+		location.Name = proto.String(positional[3])
+	}
+	if len(positional) > 4 {
+		location.Address = proto.String(strings.Join(positional[4:], " "))
+	}
+	msg := &waProto.Message{LocationMessage: location}
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
+	if err != nil {
+		return nil, c.failf("Error sending location message: %v", err)
+	}
+	c.Logger.Infof("Location message sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
+}
+
+func buildLiveLocation(lat, lon float64, caption string, sequence int64, started time.Time) *waProto.Message {
+	return &waProto.Message{LiveLocationMessage: &waProto.LiveLocationMessage{
+		DegreesLatitude:  proto.Float64(lat),
+		DegreesLongitude: proto.Float64(lon),
+		Caption:          proto.String(caption),
+		SequenceNumber:   proto.Int64(sequence),
+		TimeOffset:       proto.Uint32(uint32(time.Since(started).Seconds())),
+	}}
+}
+
+// startLiveLocation sends the first live location message and then keeps sending
+// updates every interval until duration has passed. Updates re-read the source file
+// if one is given, otherwise they repeat the initial position.
+func (c *Client) startLiveLocation(recipient types.JID, lat, lon float64, caption string, duration, interval time.Duration, source string, opts *SendOptions) (*CommandResult, error) {
+	if source != "" {
+		var err error
+		lat, lon, err = readCoordinatesFile(source)
+		if err != nil {
+			return nil, c.failf("Failed to read position from %s: %v", source, err)
+		}
+	}
+	started := time.Now()
+	msg := buildLiveLocation(lat, lon, caption, 1, started)
+	if err := c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
+	if err != nil {
+		return nil, c.failf("Error sending live location message: %v", err)
+	}
+	c.Logger.Infof("Live location message sent (server timestamp: %s), sharing for %s", resp.Timestamp, duration)
+
+	c.BackgroundJobs.Add(1)
+	go func() {
+		defer c.BackgroundJobs.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		deadline := started.Add(duration)
+		for sequence := int64(2); ; sequence++ {
+			<-ticker.C
+			if time.Now().After(deadline) {
+				break
+			}
+			if source != "" {
+				newLat, newLon, err := readCoordinatesFile(source)
+				if err != nil {
+					c.Logger.Warnf("Failed to read position from %s, repeating the last one: %v", source, err)
+				} else {
+					lat, lon = newLat, newLon
+				}
+			}
+			_, err := c.sendMessage(recipient, buildLiveLocation(lat, lon, caption, sequence, started))
+			if err != nil {
+				c.Logger.Errorf("Failed to send live location update to %s: %v", recipient, err)
+			}
+		}
+		c.Logger.Infof("Stopped sharing live location with %s", recipient)
+	}()
+	return sendResult(resp), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCoordinates(t *testing.T) {
+	tests := []struct {
+		lat, lon string
+		wantLat  float64
+		wantLon  float64
+		wantErr  string
+	}{
+		{"48.8584", "2.2945", 48.8584, 2.2945, ""},
+		{" -33.8568 ", "151.2153", -33.8568, 151.2153, ""},
+		{"90", "-180", 90, -180, ""},
+		{"90.1", "0", 0, 0, "invalid latitude"},
+		{"0", "180.5", 0, 0, "invalid longitude"},
+		{"north", "0", 0, 0, "invalid latitude"},
+		{"NaN", "0", 0, 0, "invalid latitude"},
+		{"0", "nan", 0, 0, "invalid longitude"},
+		{"0", "Inf", 0, 0, "invalid longitude"},
+	}
+	for _, test := range tests {
+		t.Run(test.lat+","+test.lon, func(t *testing.T) {
+			lat, lon, err := parseCoordinates(test.lat, test.lon)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseCoordinates() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseCoordinates() error = %v", err)
+			}
+			if lat != test.wantLat || lon != test.wantLon {
+				t.Errorf("parseCoordinates() = %v, %v, want %v, %v", lat, lon, test.wantLat, test.wantLon)
+			}
+		})
+	}
+}
+
+func TestReadCoordinatesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", "48.8584,2.2945\n", ""},
+		{"missing comma", "48.8584 2.2945", "expected <lat>,<lon>"},
+		{"invalid", "48.8584,east", "invalid longitude"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "position")
+			if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lat, lon, err := readCoordinatesFile(path)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("readCoordinatesFile() error = %v, want %q", err, test.wantErr)
+				}
+			} else if err != nil || lat != 48.8584 || lon != 2.2945 {
+				t.Fatalf("readCoordinatesFile() = %v, %v, %v", lat, lon, err)
+			}
+		})
+	}
+}
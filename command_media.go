@@ -7,25 +7,22 @@ import (
 	"wahelper/utils"
 )
 
-func (c *Client) handleMediaConnCommand(args []string) error {
+func (c *Client) handleMediaConnCommand(args []string) (*CommandResult, error) {
 	conn, err := c.WAClient.DangerousInternals().RefreshMediaConn(false)
 	if err != nil {
-		c.Logger.Errorf("Failed to get media connection: %v", err)
-	} else {
-		c.Logger.Infof("Media connection: %+v", conn)
+		return nil, c.failf("Failed to get media connection: %v", err)
 	}
-	return err
+	c.Logger.Infof("Media connection: %+v", conn)
+	return &CommandResult{Data: conn}, nil
 }
 
-func (c *Client) handleGetAvatarCommand(args []string) error {
+func (c *Client) handleGetAvatarCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getavatar <jid> [existing ID] [--preview] [--community]")
-		return nil
+		return nil, c.failf("Usage: getavatar <jid> [existing ID] [--preview] [--community]")
 	}
 	jid, ok := utils.ParseJID(args[0])
 	if !ok {
-		c.Logger.Errorf("Invalid JID: %s", args[0])
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	existingID := ""
 	var preview, isCommunity bool
@@ -37,15 +34,13 @@ func (c *Client) handleGetAvatarCommand(args []string) error {
 			case "--community":
 				isCommunity = true
 			default:
-				c.Logger.Errorf("Unknown flag: %s", arg)
-				return nil
+				return nil, c.failf("Unknown flag: %s", arg)
 			}
 		} else {
 			if existingID == "" {
 				existingID = arg
 			} else {
-				c.Logger.Errorf("Unexpected argument: %s", arg)
-				return nil
+				return nil, c.failf("Unexpected argument: %s", arg)
 			}
 		}
 	}
@@ -55,12 +50,11 @@ func (c *Client) handleGetAvatarCommand(args []string) error {
 		ExistingID:  existingID,
 	})
 	if err != nil {
-		c.Logger.Errorf("Failed to get avatar: %v", err)
-		return err
+		return nil, c.failf("Failed to get avatar: %v", err)
 	} else if pic != nil {
 		c.Logger.Infof("Got avatar ID %s: %s", pic.ID, pic.URL)
 	} else {
 		c.Logger.Infof("No avatar found")
 	}
-	return nil
+	return &CommandResult{Data: pic}, nil
 }
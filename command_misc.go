@@ -16,20 +16,19 @@ import (
     "wahelper/utils"
 )
 
-func (c *Client) handleReconnectCommand(args []string) error {
+func (c *Client) handleReconnectCommand(args []string) (*CommandResult, error) {
     c.IsConnected = false
     c.WAClient.Disconnect()
     err := c.WAClient.Connect()
     if err != nil {
-        c.Logger.Errorf("Failed to reconnect: %v", err)
+        return nil, c.failf("Failed to reconnect: %v", err)
     }
-    return err
+    return nil, nil
 }
 
-func (c *Client) handleAppStateCommand(args []string) error {
+func (c *Client) handleAppStateCommand(args []string) (*CommandResult, error) {
     if len(args) == 0 {
-        c.Logger.Errorf("Usage: appstate [resync] <names...>")
-        return nil
+        return nil, c.failf("Usage: appstate [resync] <names...>")
     }
     resync := false
     names := []appstate.WAPatchName{}
@@ -41,45 +40,41 @@ func (c *Client) handleAppStateCommand(args []string) error {
         }
     }
     if len(names) == 0 {
-        c.Logger.Errorf("No patch names provided.")
-        return nil
+        return nil, c.failf("No patch names provided.")
     }
     for _, name := range names {
         c.WAClient.FetchAppState(name, resync, false)
     }
-    return nil
+    return nil, nil
 }
 
-func (c *Client) handleRequestAppStateKeyCommand(args []string) error {
+func (c *Client) handleRequestAppStateKeyCommand(args []string) (*CommandResult, error) {
     if len(args) < 1 {
-        c.Logger.Errorf("Usage: request-appstate-key <ids...>")
-        return nil
+        return nil, c.failf("Usage: request-appstate-key <ids...>")
     }
     var keyIDs = make([][]byte, len(args))
     for i, id := range args {
         decoded, err := hex.DecodeString(id)
         if err != nil {
-            c.Logger.Errorf("Failed to decode %s as hex: %v", id, err)
-            return nil
+            return nil, c.failf("Failed to decode %s as hex: %v", id, err)
         }
         keyIDs[i] = decoded
     }
     c.WAClient.DangerousInternals().RequestAppStateKeys(context.Background(), keyIDs)
-    return nil
+    return nil, nil
 }
 
-func (c *Client) handleUnavailableRequestCommand(args []string) error {
+func (c *Client) handleUnavailableRequestCommand(args []string) (*CommandResult, error) {
     if len(args) < 3 {
-        c.Logger.Errorf("Usage: unavailable-request <chat JID> <sender JID> <message ID>")
-        return nil
+        return nil, c.failf("Usage: unavailable-request <chat JID> <sender JID> <message ID>")
     }
     chat, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     sender, ok := utils.ParseJID(args[1])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[1])
     }
     msg := c.WAClient.BuildUnavailableMessageRequest(chat, sender, args[2])
     resp, err := c.WAClient.SendMessage(
@@ -89,73 +84,65 @@ func (c *Client) handleUnavailableRequestCommand(args []string) error {
         types.SendRequestExtra{Peer: true},
     )
     if err != nil {
-        c.Logger.Errorf("Error sending unavailable request: %v", err)
-    } else {
-        c.Logger.Infof("Unavailable request sent: %+v", resp)
+        return nil, c.failf("Error sending unavailable request: %v", err)
     }
-    return err
+    c.Logger.Infof("Unavailable request sent: %+v", resp)
+    return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleCheckUserCommand(args []string) error {
+func (c *Client) handleCheckUserCommand(args []string) (*CommandResult, error) {
     if len(args) < 1 {
-        c.Logger.Errorf("Usage: checkuser <phone numbers...>")
-        return nil
+        return nil, c.failf("Usage: checkuser <phone numbers...>")
     }
     resp, err := c.WAClient.IsOnWhatsApp(args)
     if err != nil {
-        c.Logger.Errorf("Failed to check if users are on WhatsApp: %s", err.Error())
-    } else {
-        for _, item := range resp {
-            if item.VerifiedName != nil {
-                c.Logger.Infof("%s: on WhatsApp: %t, JID: %s, business name: %s", item.Query, item.IsIn, item.JID, item.VerifiedName.Details.GetVerifiedName())
-            } else {
-                c.Logger.Infof("%s: on WhatsApp: %t, JID: %s", item.Query, item.IsIn, item.JID)
-            }
+        return nil, c.failf("Failed to check if users are on WhatsApp: %s", err.Error())
+    }
+    for _, item := range resp {
+        if item.VerifiedName != nil {
+            c.Logger.Infof("%s: on WhatsApp: %t, JID: %s, business name: %s", item.Query, item.IsIn, item.JID, item.VerifiedName.Details.GetVerifiedName())
+        } else {
+            c.Logger.Infof("%s: on WhatsApp: %t, JID: %s", item.Query, item.IsIn, item.JID)
         }
     }
-    return err
+    return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleSubscribePresenceCommand(args []string) error {
+func (c *Client) handleSubscribePresenceCommand(args []string) (*CommandResult, error) {
     if len(args) < 1 {
-        c.Logger.Errorf("Usage: subscribepresence <jid>")
-        return nil
+        return nil, c.failf("Usage: subscribepresence <jid>")
     }
     jid, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     err := c.WAClient.SubscribePresence(jid)
     if err != nil {
-        c.Logger.Errorf("Error subscribing to presence: %v", err)
-    } else {
-        c.Logger.Infof("Subscribed to presence updates for %s", jid)
+        return nil, c.failf("Error subscribing to presence: %v", err)
     }
-    return err
+    c.Logger.Infof("Subscribed to presence updates for %s", jid)
+    return nil, nil
 }
 
-func (c *Client) handlePresenceCommand(args []string) error {
+func (c *Client) handlePresenceCommand(args []string) (*CommandResult, error) {
     if len(args) == 0 {
-        c.Logger.Errorf("Usage: presence <available/unavailable>")
-        return nil
+        return nil, c.failf("Usage: presence <available/unavailable>")
     }
     err := c.WAClient.SendPresence(types.Presence(args[0]))
     if err != nil {
-        c.Logger.Errorf("Error sending presence: %v", err)
-    } else {
-        c.Logger.Infof("Presence set to %s", args[0])
+        return nil, c.failf("Error sending presence: %v", err)
     }
-    return err
+    c.Logger.Infof("Presence set to %s", args[0])
+    return nil, nil
 }
 
-func (c *Client) handleChatPresenceCommand(args []string) error {
+func (c *Client) handleChatPresenceCommand(args []string) (*CommandResult, error) {
     if len(args) < 2 {
-        c.Logger.Errorf("Usage: chatpresence <jid> <composing/paused> [audio]")
-        return nil
+        return nil, c.failf("Usage: chatpresence <jid> <composing/paused> [audio]")
     }
     jid, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     presence := types.ChatPresence(args[1])
     media := types.ChatPresenceMedia("")
@@ -164,155 +151,138 @@ func (c *Client) handleChatPresenceCommand(args []string) error {
     }
     err := c.WAClient.SendChatPresence(jid, presence, media)
     if err != nil {
-        c.Logger.Errorf("Error sending chat presence: %v", err)
-    } else {
-        c.Logger.Infof("Chat presence sent to %s", jid)
+        return nil, c.failf("Error sending chat presence: %v", err)
     }
-    return err
+    c.Logger.Infof("Chat presence sent to %s", jid)
+    return nil, nil
 }
 
-func (c *Client) handleGetUserCommand(args []string) error {
+func (c *Client) handleGetUserCommand(args []string) (*CommandResult, error) {
     if len(args) < 1 {
-        c.Logger.Errorf("Usage: getuser <jids...>")
-        return nil
+        return nil, c.failf("Usage: getuser <jids...>")
     }
     var jids []types.JID
     for _, arg := range args {
         jid, ok := utils.ParseJID(arg)
         if !ok {
-            return nil
+            return nil, c.failf("Invalid JID: %s", arg)
         }
         jids = append(jids, jid)
     }
     resp, err := c.WAClient.GetUserInfo(jids)
     if err != nil {
-        c.Logger.Errorf("Failed to get user info: %v", err)
-    } else {
-        for jid, info := range resp {
-            c.Logger.Infof("%s: %+v", jid, info)
-        }
+        return nil, c.failf("Failed to get user info: %v", err)
+    }
+    for jid, info := range resp {
+        c.Logger.Infof("%s: %+v", jid, info)
     }
-    return err
+    return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleRawCommand(args []string) error {
+func (c *Client) handleRawCommand(args []string) (*CommandResult, error) {
     var node waBinary.Node
     if err := json.Unmarshal([]byte(strings.Join(args, " ")), &node); err != nil {
-        c.Logger.Errorf("Failed to parse args as JSON into XML node: %v", err)
+        return nil, c.failf("Failed to parse args as JSON into XML node: %v", err)
     } else if err = c.WAClient.DangerousInternals().SendNode(node); err != nil {
-        c.Logger.Errorf("Error sending node: %v", err)
-    } else {
-        c.Logger.Infof("Node sent")
+        return nil, c.failf("Error sending node: %v", err)
     }
-    return nil
+    c.Logger.Infof("Node sent")
+    return nil, nil
 }
 
-func (c *Client) handleQueryBusinessLinkCommand(args []string) error {
+func (c *Client) handleQueryBusinessLinkCommand(args []string) (*CommandResult, error) {
     if len(args) < 1 {
-        c.Logger.Errorf("Usage: querybusinesslink <link>")
-        return nil
+        return nil, c.failf("Usage: querybusinesslink <link>")
     }
     resp, err := c.WAClient.ResolveBusinessMessageLink(args[0])
     if err != nil {
-        c.Logger.Errorf("Failed to resolve business message link: %v", err)
-    } else {
-        c.Logger.Infof("Business info: %+v", resp)
+        return nil, c.failf("Failed to resolve business message link: %v", err)
     }
-    return err
+    c.Logger.Infof("Business info: %+v", resp)
+    return &CommandResult{Data: resp}, nil
 }
 
-func (c *Client) handleListUsersCommand(args []string) error {
+func (c *Client) handleListUsersCommand(args []string) (*CommandResult, error) {
     users, err := c.WAClient.Store.Contacts.GetAllContacts()
     if err != nil {
-        c.Logger.Errorf("Failed to get user list: %v", err)
-    } else {
-        jids := make([]string, 0, len(users))
-        for jid := range users {
-            jids = append(jids, jid.String())
-        }
-        output := struct {
-            JIDs  []string                        `json:"jids"`
-            Users map[types.JID]types.ContactInfo `json:"users"`
-        }{
-            JIDs:  jids,
-            Users: users,
-        }
-        jsonContent, err := json.MarshalIndent(output, "", "  ")
-        if err != nil {
-            c.Logger.Errorf("Error marshaling users to JSON: %v", err)
-            return err
-        }
-        fmt.Print(string(jsonContent))
+        return nil, c.failf("Failed to get user list: %v", err)
+    }
+    jids := make([]string, 0, len(users))
+    for jid := range users {
+        jids = append(jids, jid.String())
+    }
+    output := struct {
+        JIDs  []string                        `json:"jids"`
+        Users map[types.JID]types.ContactInfo `json:"users"`
+    }{
+        JIDs:  jids,
+        Users: users,
     }
-    return err
+    jsonContent, err := json.MarshalIndent(output, "", "  ")
+    if err != nil {
+        return nil, c.failf("Error marshaling users to JSON: %v", err)
+    }
+    fmt.Print(string(jsonContent))
+    return &CommandResult{Data: output}, nil
 }
 
-func (c *Client) handleListGroupsCommand(args []string) error {
+func (c *Client) handleListGroupsCommand(args []string) (*CommandResult, error) {
     groups, err := c.WAClient.GetJoinedGroups()
     if err != nil {
-        c.Logger.Errorf("Failed to get group list: %v", err)
-    } else {
-        jsonContent, err := json.MarshalIndent(groups, "", "  ")
-        if err != nil {
-            c.Logger.Errorf("Error marshaling groups to JSON: %v", err)
-            return err
-        }
-        result := map[string]interface{}{
-            "groups": json.RawMessage(jsonContent),
-        }
-        output, err := json.MarshalIndent(result, "", "  ")
-        if err != nil {
-            c.Logger.Errorf("Error marshaling result to JSON: %v", err)
-            return err
-        }
-        fmt.Print(string(output))
+        return nil, c.failf("Failed to get group list: %v", err)
+    }
+    jsonContent, err := json.MarshalIndent(groups, "", "  ")
+    if err != nil {
+        return nil, c.failf("Error marshaling groups to JSON: %v", err)
     }
-    return err
+    result := map[string]interface{}{
+        "groups": json.RawMessage(jsonContent),
+    }
+    output, err := json.MarshalIndent(result, "", "  ")
+    if err != nil {
+        return nil, c.failf("Error marshaling result to JSON: %v", err)
+    }
+    fmt.Print(string(output))
+    return &CommandResult{Data: result}, nil
 }
 
-func (c *Client) handleArchiveCommand(args []string) error {
+func (c *Client) handleArchiveCommand(args []string) (*CommandResult, error) {
     if len(args) < 2 {
-        c.Logger.Errorf("Usage: archive <jid> <true/false>")
-        return nil
+        return nil, c.failf("Usage: archive <jid> <true/false>")
     }
     target, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     action, err := strconv.ParseBool(args[1])
     if err != nil {
-        c.Logger.Errorf("Invalid second argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid second argument: %v", err)
     }
     err = c.WAClient.SendAppState(appstate.BuildArchive(target, action, time.Time{}, nil))
     if err != nil {
-        c.Logger.Errorf("Error changing chat's archive state: %v", err)
-    } else {
-        c.Logger.Infof("Archive state changed for %s to %t", target, action)
+        return nil, c.failf("Error changing chat's archive state: %v", err)
     }
-    return err
+    c.Logger.Infof("Archive state changed for %s to %t", target, action)
+    return nil, nil
 }
 
-func (c *Client) handleMuteCommand(args []string) error {
+func (c *Client) handleMuteCommand(args []string) (*CommandResult, error) {
     if len(args) < 2 {
-        c.Logger.Errorf("Usage: mute <jid> <true/false> [hours] (default is 8hrs, if 0 then indefinitely)")
-        return nil
+        return nil, c.failf("Usage: mute <jid> <true/false> [hours] (default is 8hrs, if 0 then indefinitely)")
     }
     target, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     action, err := strconv.ParseBool(args[1])
     if err != nil {
-        c.Logger.Errorf("Invalid second argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid second argument: %v", err)
     }
     var duration time.Duration
     if len(args) > 2 {
         t, err := strconv.ParseInt(args[2], 10, 64)
         if err != nil {
-            c.Logger.Errorf("Invalid duration: %v", err)
-            return nil
+            return nil, c.failf("Invalid duration: %v", err)
         }
         if t == 0 {
             duration = 0 // Indefinite mute
@@ -324,107 +294,93 @@ func (c *Client) handleMuteCommand(args []string) error {
     }
     err = c.WAClient.SendAppState(appstate.BuildMute(target, action, duration))
     if err != nil {
-        c.Logger.Errorf("Error changing chat's mute state: %v", err)
-    } else {
-        c.Logger.Infof("Mute state changed for %s to %t for %s", target, action, duration)
+        return nil, c.failf("Error changing chat's mute state: %v", err)
     }
-    return err
+    c.Logger.Infof("Mute state changed for %s to %t for %s", target, action, duration)
+    return nil, nil
 }
 
-func (c *Client) handlePinCommand(args []string) error {
+func (c *Client) handlePinCommand(args []string) (*CommandResult, error) {
     if len(args) < 2 {
-        c.Logger.Errorf("Usage: pin <jid> <true/false>")
-        return nil
+        return nil, c.failf("Usage: pin <jid> <true/false>")
     }
     target, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     action, err := strconv.ParseBool(args[1])
     if err != nil {
-        c.Logger.Errorf("Invalid second argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid second argument: %v", err)
     }
     err = c.WAClient.SendAppState(appstate.BuildPin(target, action))
     if err != nil {
-        c.Logger.Errorf("Error changing chat's pin state: %v", err)
-    } else {
-        c.Logger.Infof("Pin state changed for %s to %t", target, action)
+        return nil, c.failf("Error changing chat's pin state: %v", err)
     }
-    return err
+    c.Logger.Infof("Pin state changed for %s to %t", target, action)
+    return nil, nil
 }
 
-func (c *Client) handleLabelChatCommand(args []string) error {
+func (c *Client) handleLabelChatCommand(args []string) (*CommandResult, error) {
     if len(args) < 3 {
-        c.Logger.Errorf("Usage: labelchat <jid> <labelID> <true/false>")
-        return nil
+        return nil, c.failf("Usage: labelchat <jid> <labelID> <true/false>")
     }
     jid, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     labelID := args[1]
     action, err := strconv.ParseBool(args[2])
     if err != nil {
-        c.Logger.Errorf("Invalid third argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid third argument: %v", err)
     }
     err = c.WAClient.SendAppState(appstate.BuildLabelChat(jid, labelID, action))
     if err != nil {
-        c.Logger.Errorf("Error changing chat's label state: %v", err)
-    } else {
-        c.Logger.Infof("Label state changed for chat %s, label ID %s, action %t", jid, labelID, action)
+        return nil, c.failf("Error changing chat's label state: %v", err)
     }
-    return err
+    c.Logger.Infof("Label state changed for chat %s, label ID %s, action %t", jid, labelID, action)
+    return nil, nil
 }
 
-func (c *Client) handleLabelMessageCommand(args []string) error {
+func (c *Client) handleLabelMessageCommand(args []string) (*CommandResult, error) {
     if len(args) < 4 {
-        c.Logger.Errorf("Usage: labelmessage <jid> <labelID> <messageID> <true/false>")
-        return nil
+        return nil, c.failf("Usage: labelmessage <jid> <labelID> <messageID> <true/false>")
     }
     jid, ok := utils.ParseJID(args[0])
     if !ok {
-        return nil
+        return nil, c.failf("Invalid JID: %s", args[0])
     }
     labelID := args[1]
     messageID := args[2]
     action, err := strconv.ParseBool(args[3])
     if err != nil {
-        c.Logger.Errorf("Invalid fourth argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid fourth argument: %v", err)
     }
     err = c.WAClient.SendAppState(appstate.BuildLabelMessage(jid, labelID, messageID, action))
     if err != nil {
-        c.Logger.Errorf("Error changing message's label state: %v", err)
-    } else {
-        c.Logger.Infof("Label state changed for message %s in chat %s, label ID %s, action %t", messageID, jid, labelID, action)
+        return nil, c.failf("Error changing message's label state: %v", err)
     }
-    return err
+    c.Logger.Infof("Label state changed for message %s in chat %s, label ID %s, action %t", messageID, jid, labelID, action)
+    return nil, nil
 }
 
-func (c *Client) handleEditLabelCommand(args []string) error {
+func (c *Client) handleEditLabelCommand(args []string) (*CommandResult, error) {
     if len(args) < 4 {
-        c.Logger.Errorf("Usage: editlabel <labelID> <name> <color> <true/false>")
-        return nil
+        return nil, c.failf("Usage: editlabel <labelID> <name> <color> <true/false>")
     }
     labelID := args[0]
     name := args[1]
     color, err := strconv.Atoi(args[2])
     if err != nil {
-        c.Logger.Errorf("Invalid third argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid third argument: %v", err)
     }
     action, err := strconv.ParseBool(args[3])
     if err != nil {
-        c.Logger.Errorf("Invalid fourth argument: %v", err)
-        return nil
+        return nil, c.failf("Invalid fourth argument: %v", err)
     }
     err = c.WAClient.SendAppState(appstate.BuildLabelEdit(labelID, name, int32(color), action))
     if err != nil {
-        c.Logger.Errorf("Error editing label: %v", err)
-    } else {
-        c.Logger.Infof("Label edited: label ID %s, name %s, color %d, action %t", labelID, name, color, action)
+        return nil, c.failf("Error editing label: %v", err)
     }
-    return err
+    c.Logger.Infof("Label edited: label ID %s, name %s, color %d, action %t", labelID, name, color, action)
+    return nil, nil
 }
@@ -10,84 +10,75 @@ import (
 	"wahelper/utils"
 )
 
-func (c *Client) handleListNewslettersCommand(args []string) error {
+func (c *Client) handleListNewslettersCommand(args []string) (*CommandResult, error) {
 	newsletters, err := c.WAClient.GetSubscribedNewsletters()
 	if err != nil {
-		c.Logger.Errorf("Failed to get subscribed newsletters: %v", err)
-		return err
+		return nil, c.failf("Failed to get subscribed newsletters: %v", err)
 	}
 	for _, newsletter := range newsletters {
 		c.Logger.Infof("* %s: %s", newsletter.ID, newsletter.ThreadMeta.Name.Text)
 	}
-	return nil
+	return &CommandResult{Data: newsletters}, nil
 }
 
-func (c *Client) handleGetNewsletterCommand(args []string) error {
+func (c *Client) handleGetNewsletterCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getnewsletter <jid>")
-		return nil
+		return nil, c.failf("Usage: getnewsletter <jid>")
 	}
 	jid, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	meta, err := c.WAClient.GetNewsletterInfo(jid)
 	if err != nil {
-		c.Logger.Errorf("Failed to get info: %v", err)
-	} else {
-		c.Logger.Infof("Got info: %+v", meta)
+		return nil, c.failf("Failed to get info: %v", err)
 	}
-	return err
+	c.Logger.Infof("Got info: %+v", meta)
+	return &CommandResult{Data: meta}, nil
 }
 
-func (c *Client) handleGetNewsletterInviteCommand(args []string) error {
+func (c *Client) handleGetNewsletterInviteCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getnewsletterinvite <link>")
-		return nil
+		return nil, c.failf("Usage: getnewsletterinvite <link>")
 	}
 	meta, err := c.WAClient.GetNewsletterInfoWithInvite(args[0])
 	if err != nil {
-		c.Logger.Errorf("Failed to get info: %v", err)
-	} else {
-		c.Logger.Infof("Got info: %+v", meta)
+		return nil, c.failf("Failed to get info: %v", err)
 	}
-	return err
+	c.Logger.Infof("Got info: %+v", meta)
+	return &CommandResult{Data: meta}, nil
 }
 
-func (c *Client) handleLiveSubscribeNewsletterCommand(args []string) error {
+func (c *Client) handleLiveSubscribeNewsletterCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: livesubscribenewsletter <jid>")
-		return nil
+		return nil, c.failf("Usage: livesubscribenewsletter <jid>")
 	}
 	jid, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	dur, err := c.WAClient.NewsletterSubscribeLiveUpdates(context.TODO(), jid)
 	if err != nil {
-		c.Logger.Errorf("Failed to subscribe to live updates: %v", err)
-	} else {
-		c.Logger.Infof("Subscribed to live updates for %s for %s", jid, dur)
+		return nil, c.failf("Failed to subscribe to live updates: %v", err)
 	}
-	return err
+	c.Logger.Infof("Subscribed to live updates for %s for %s", jid, dur)
+	return &CommandResult{Data: dur.String()}, nil
 }
 
-func (c *Client) handleGetNewsletterMessagesCommand(args []string) error {
+func (c *Client) handleGetNewsletterMessagesCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: getnewslettermessages <jid> [count] [before id]")
-		return nil
+		return nil, c.failf("Usage: getnewslettermessages <jid> [count] [before id]")
 	}
 	jid, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	count := 100
 	if len(args) > 1 {
 		var err error
 		count, err = strconv.Atoi(args[1])
 		if err != nil {
-			c.Logger.Errorf("Invalid count: %v", err)
-			return nil
+			return nil, c.failf("Invalid count: %v", err)
 		}
 	}
 	var before *types.MessageServerID
@@ -97,27 +88,24 @@ func (c *Client) handleGetNewsletterMessagesCommand(args []string) error {
 	}
 	messages, err := c.WAClient.GetNewsletterMessages(jid, &whatsmeow.GetNewsletterMessagesParams{Count: count, Before: before})
 	if err != nil {
-		c.Logger.Errorf("Failed to get messages: %v", err)
-	} else {
-		for _, msg := range messages {
-			c.Logger.Infof("%s: %+v (viewed %d times)", msg.MessageServerID, msg.Message, msg.ViewsCount)
-		}
+		return nil, c.failf("Failed to get messages: %v", err)
+	}
+	for _, msg := range messages {
+		c.Logger.Infof("%s: %+v (viewed %d times)", msg.MessageServerID, msg.Message, msg.ViewsCount)
 	}
-	return err
+	return &CommandResult{Data: messages}, nil
 }
 
-func (c *Client) handleCreateNewsletterCommand(args []string) error {
+func (c *Client) handleCreateNewsletterCommand(args []string) (*CommandResult, error) {
 	if len(args) < 1 {
-		c.Logger.Errorf("Usage: createnewsletter <name>")
-		return nil
+		return nil, c.failf("Usage: createnewsletter <name>")
 	}
 	resp, err := c.WAClient.CreateNewsletter(whatsmeow.CreateNewsletterParams{
 		Name: strings.Join(args, " "),
 	})
 	if err != nil {
-		c.Logger.Errorf("Failed to create newsletter: %v", err)
-	} else {
-		c.Logger.Infof("Created newsletter %+v", resp)
+		return nil, c.failf("Failed to create newsletter: %v", err)
 	}
-	return err
+	c.Logger.Infof("Created newsletter %+v", resp)
+	return &CommandResult{Data: resp}, nil
 }
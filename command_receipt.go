@@ -0,0 +1,122 @@
+package main
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// receiptStatuses maps the receipt types sent for our own messages to the recorded status.
+var receiptStatuses = map[types.ReceiptType]string{
+	types.ReceiptTypeDelivered: "delivered",
+	types.ReceiptTypeRead:      "read",
+	types.ReceiptTypePlayed:    "played",
+}
+
+// MessageStatus is the delivery state of a message we sent, per recipient.
+type MessageStatus struct {
+	MessageID  string            `json:"message_id"`
+	Chat       string            `json:"chat"`
+	Status     string            `json:"status"`
+	Delivered  int               `json:"delivered"`
+	Read       int               `json:"read"`
+	Recipients []RecipientStatus `json:"recipients"`
+	Pending    []string          `json:"pending,omitempty"`
+}
+
+// handleReceipt records a receipt for our messages and forwards it to the webhook in
+// --mode both. Receipts from our own other devices are ignored.
+func (c *Client) handleReceipt(evt *events.Receipt) {
+	status, ok := receiptStatuses[evt.Type]
+	if !ok || evt.IsFromMe || len(evt.MessageIDs) == 0 {
+		return
+	}
+	err := c.Receipts.SaveReceipt(evt.Chat, evt.MessageIDs, evt.Sender, status, evt.Timestamp)
+	if err != nil {
+		c.Logger.Warnf("Failed to record %s receipt of %v: %v", status, evt.MessageIDs, err)
+	}
+	if c.Config.Mode != "both" {
+		return
+	}
+
+	event := c.newWebhookEvent("receipt")
+	event.Timestamp = evt.Timestamp
+	event.Chat = &WebhookChat{JID: evt.Chat.String(), IsGroup: evt.IsGroup}
+	if evt.IsGroup {
+		event.Chat.GroupName = c.groupName(evt.Chat)
+	}
+	if len(evt.MessageIDs) == 1 {
+		event.MessageID = evt.MessageIDs[0]
+	}
+	event.Receipt = &WebhookReceipt{
+		Status:     status,
+		MessageIDs: evt.MessageIDs,
+		Recipient:  evt.Sender.ToNonAD().String(),
+	}
+	c.sendWebhookEvent(event)
+}
+
+func (c *Client) handleMsgStatusCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: msgstatus <message ID>")
+	}
+	chat, recipients, err := c.Receipts.GetReceipts(args[0])
+	if err != nil {
+		return nil, c.failf("Failed to get receipts: %v", err)
+	}
+	if chat == "" {
+		stored, err := c.History.GetMessage(args[0])
+		if err != nil {
+			return nil, c.failf("Failed to get message: %v", err)
+		} else if stored == nil {
+			return nil, c.failf("Unknown message: %s", args[0])
+		}
+		chat = stored.Chat
+	}
+	status := &MessageStatus{MessageID: args[0], Chat: chat, Status: "sent", Recipients: recipients}
+
+	received := make(map[string]bool)
+	for i, recipient := range recipients {
+		received[recipient.JID] = true
+		rank := receiptStatusRank[recipient.Status]
+		if rank >= receiptStatusRank["delivered"] {
+			status.Delivered++
+		}
+		if rank >= receiptStatusRank["read"] {
+			status.Read++
+		}
+		// The overall status is the least progress among the recipients
+		if i == 0 || rank < receiptStatusRank[status.Status] {
+			status.Status = recipient.Status
+		}
+	}
+
+	chatJID, err := types.ParseJID(chat)
+	if err == nil && chatJID.Server == types.GroupServer {
+		info, err := c.getGroupInfo(chatJID)
+		if err != nil {
+			c.Logger.Warnf("Failed to get members of %s: %v", chat, err)
+		} else {
+			for _, participant := range info.Participants {
+				jid := participant.JID.ToNonAD()
+				if c.WAClient.Store.ID != nil && jid.User == c.WAClient.Store.ID.User {
+					continue
+				}
+				if !received[jid.String()] {
+					status.Pending = append(status.Pending, jid.String())
+				}
+			}
+			if len(status.Pending) > 0 {
+				status.Status = "sent"
+			}
+		}
+	}
+
+	c.Logger.Infof("Message %s in %s: %s (%d delivered, %d read)", status.MessageID, status.Chat, status.Status, status.Delivered, status.Read)
+	for _, recipient := range status.Recipients {
+		c.Logger.Infof("* %s: %s", recipient.JID, recipient.Status)
+	}
+	for _, jid := range status.Pending {
+		c.Logger.Infof("* %s: pending", jid)
+	}
+	return &CommandResult{Data: status}, nil
+}
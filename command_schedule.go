@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"wahelper/utils"
+)
+
+const (
+	// schedulerInterval is how often the scheduler looks for due jobs.
+	schedulerInterval = time.Second
+	// scheduleMissedAfter is how late a job may run before it counts as missed.
+	scheduleMissedAfter = time.Minute
+)
+
+// parseScheduleWhen parses an RFC3339 or unix timestamp, a relative duration like +2h,
+// or a cron expression. For cron expressions the expression is returned as well.
+func parseScheduleWhen(when string, now time.Time) (time.Time, string, error) {
+	switch {
+	case strings.HasPrefix(when, "+"):
+		duration, err := time.ParseDuration(when[1:])
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid duration: %w", err)
+		}
+		return now.Add(duration), "", nil
+	case strings.HasPrefix(when, "@") || strings.Contains(when, " "):
+		schedule, err := cron.ParseStandard(when)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid cron expression: %w", err)
+		}
+		return schedule.Next(now), when, nil
+	default:
+		at, err := utils.ParseTimestamp(when)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid time (use RFC3339, +duration or a cron expression): %w", err)
+		}
+		return at, "", nil
+	}
+}
+
+// nextCronRun returns the first run of a cron expression after the given time.
+func nextCronRun(expr string, after time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(after), nil
+}
+
+// RunScheduler runs due scheduled jobs until the process exits. Jobs that are more
+// than scheduleMissedAfter late, usually because wahelper wasn't running, are caught
+// up or skipped depending on --schedule-missed.
+func (c *Client) RunScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !c.WAClient.IsConnected() || !c.WAClient.IsLoggedIn() {
+			continue
+		}
+		now := time.Now()
+		jobs, err := c.Schedules.GetJobs(now, false)
+		if err != nil {
+			c.Logger.Errorf("Failed to get due scheduled jobs: %v", err)
+			continue
+		}
+		for _, job := range jobs {
+			c.runScheduledJob(job, now)
+		}
+	}
+}
+
+func (c *Client) runScheduledJob(job *ScheduledJob, now time.Time) {
+	missed := now.Sub(job.NextRun) > scheduleMissedAfter
+	status := ScheduleStatusDone
+	var nextRun time.Time
+	if job.Cron != "" {
+		status = ScheduleStatusActive
+		var err error
+		nextRun, err = nextCronRun(job.Cron, now)
+		if err != nil {
+			c.Logger.Errorf("Invalid cron expression in scheduled job %s: %v", job.ID, err)
+			status = ScheduleStatusDone
+		}
+	}
+
+	if nextRun.IsZero() {
+		nextRun = job.NextRun
+	}
+	// Claim the job first: one-shot jobs stay claimed if the process dies while they
+	// run, so they are never sent twice, and cron jobs move on to their next run
+	claimStatus := ScheduleStatusRunning
+	if status == ScheduleStatusActive {
+		claimStatus = ScheduleStatusActive
+	}
+	claimed, err := c.Schedules.ClaimJob(job, claimStatus, nextRun)
+	if err != nil {
+		c.Logger.Errorf("Failed to claim scheduled job %s: %v", job.ID, err)
+		return
+	} else if !claimed {
+		c.Logger.Debugf("Scheduled job %s was already claimed", job.ID)
+		return
+	}
+
+	lastError := ""
+	if missed && c.Config.ScheduleMissed == "skip" {
+		c.Logger.Warnf("Skipping scheduled job %s (%s) that was due at %s", job.ID, job.Command, job.NextRun.Format(time.RFC3339))
+		if job.Cron == "" {
+			status = ScheduleStatusSkipped
+		}
+		lastError = "missed"
+	} else {
+		if missed {
+			c.Logger.Warnf("Catching up on scheduled job %s (%s) that was due at %s", job.ID, job.Command, job.NextRun.Format(time.RFC3339))
+		} else {
+			c.Logger.Infof("Running scheduled job %s: %s %s", job.ID, job.Command, strings.Join(job.Args, " "))
+		}
+		_, err := c.HandleCommand(job.Command, job.Args)
+		if err != nil {
+			lastError = err.Error()
+		}
+	}
+
+	err = c.Schedules.UpdateJob(job.ID, status, nextRun, now, lastError)
+	if err != nil {
+		c.Logger.Errorf("Failed to update scheduled job %s: %v", job.ID, err)
+	}
+}
+
+func (c *Client) handleScheduleCommand(args []string) (*CommandResult, error) {
+	usage := "Usage: schedule <RFC3339 time|+duration|@daily|\"<cron expression>\"> <command> [args...]\n       schedule cron <minute> <hour> <day of month> <month> <day of week> <command> [args...]"
+	if len(args) < 2 {
+		return nil, c.failf("%s", usage)
+	}
+	when := args[0]
+	args = args[1:]
+	if when == "cron" {
+		if len(args) < 6 {
+			return nil, c.failf("%s", usage)
+		}
+		when = strings.Join(args[:5], " ")
+		args = args[5:]
+	}
+	command := strings.ToLower(args[0])
+	if _, ok := c.commandHandlers[command]; !ok {
+		return nil, c.failf("Unknown command: %s", command)
+	}
+
+	now := time.Now()
+	nextRun, cronExpr, err := parseScheduleWhen(when, now)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	} else if cronExpr == "" && nextRun.Before(now) {
+		return nil, c.failf("%s is in the past", nextRun.Format(time.RFC3339))
+	}
+
+	job := &ScheduledJob{
+		ID:      newJobID(),
+		When:    when,
+		Cron:    cronExpr,
+		Command: command,
+		Args:    args[1:],
+		Status:  ScheduleStatusActive,
+		NextRun: nextRun,
+		Created: now,
+	}
+	err = c.Schedules.AddJob(job)
+	if err != nil {
+		return nil, c.failf("Failed to schedule job: %v", err)
+	}
+	c.Logger.Infof("Scheduled job %s: %s will run at %s", job.ID, command, nextRun.Format(time.RFC3339))
+	return &CommandResult{Data: job}, nil
+}
+
+func (c *Client) handleSchedulesCommand(args []string) (*CommandResult, error) {
+	includeFinished := len(args) > 0 && args[0] == "--all"
+	jobs, err := c.Schedules.GetJobs(time.Time{}, includeFinished)
+	if err != nil {
+		return nil, c.failf("Failed to get scheduled jobs: %v", err)
+	}
+	for _, job := range jobs {
+		line := fmt.Sprintf("* %s [%s] %s %s: next run %s", job.ID, job.Status, job.Command, strings.Join(job.Args, " "), job.NextRun.Format(time.RFC3339))
+		if job.Cron != "" {
+			line += fmt.Sprintf(" (cron %q)", job.Cron)
+		}
+		if job.LastError != "" {
+			line += fmt.Sprintf(", last error: %s", job.LastError)
+		}
+		c.Logger.Infof("%s", line)
+	}
+	return &CommandResult{Data: jobs}, nil
+}
+
+func (c *Client) handleUnscheduleCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: unschedule <job ID>")
+	}
+	deleted, err := c.Schedules.DeleteJob(args[0])
+	if err != nil {
+		return nil, c.failf("Failed to delete scheduled job: %v", err)
+	} else if !deleted {
+		return nil, c.failf("Unknown scheduled job: %s", args[0])
+	}
+	c.Logger.Infof("Cancelled scheduled job %s", args[0])
+	return nil, nil
+}
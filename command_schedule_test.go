@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleWhen(t *testing.T) {
+	now := time.Date(2024, time.June, 3, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		when    string
+		want    time.Time
+		cron    string
+		wantErr string
+	}{
+		{"+90m", now.Add(90 * time.Minute), "", ""},
+		{"+2h30m", now.Add(150 * time.Minute), "", ""},
+		{"+tomorrow", time.Time{}, "", "invalid duration"},
+		{"2024-06-04T08:00:00Z", time.Date(2024, time.June, 4, 8, 0, 0, 0, time.UTC), "", ""},
+		{"1717488000", time.Unix(1717488000, 0), "", ""},
+		{"0 9 * * *", time.Date(2024, time.June, 4, 9, 0, 0, 0, time.Local), "0 9 * * *", ""},
+		{"*/15 * * * *", time.Date(2024, time.June, 3, 10, 45, 0, 0, time.Local), "*/15 * * * *", ""},
+		{"@hourly", time.Date(2024, time.June, 3, 11, 0, 0, 0, time.Local), "@hourly", ""},
+		{"0 9 * *", time.Time{}, "", "invalid cron expression"},
+		{"@sometimes", time.Time{}, "", "invalid cron expression"},
+		{"tomorrow", time.Time{}, "", "invalid time"},
+	}
+	for _, test := range tests {
+		t.Run(test.when, func(t *testing.T) {
+			at, cron, err := parseScheduleWhen(test.when, now)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseScheduleWhen() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseScheduleWhen() error = %v", err)
+			}
+			if !at.Equal(test.want) || cron != test.cron {
+				t.Errorf("parseScheduleWhen() = %s, %q, want %s, %q", at, cron, test.want, test.cron)
+			}
+		})
+	}
+}
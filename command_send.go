@@ -2,14 +2,13 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
 	_ "image/png"
 	"io"
 	"net/http"
-	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -17,7 +16,6 @@ import (
 
 	"github.com/nfnt/resize"
 	"github.com/otiai10/opengraph/v2"
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types"
 	"wahelper/utils"
 
@@ -26,52 +24,60 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-func (c *Client) handleSendCommand(args []string) error {
+func (c *Client) handleSendCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: send <jid> <text>")
-		return nil
+		return nil, c.failf("Usage: send <jid> <text> [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	msg := &waProto.Message{Conversation: proto.String(strings.Join(args[1:], " "))}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
-		c.Logger.Errorf("Error sending message: %v", err)
-	} else {
-		c.Logger.Infof("Message sent (server timestamp: %s)", resp.Timestamp)
+		return nil, c.failf("Error sending message: %v", err)
 	}
-	return nil
+	c.Logger.Infof("Message sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
 }
 
-func (c *Client) handleSendListCommand(args []string) error {
+func (c *Client) handleSendListCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	if source, ok := listSource(args); ok {
+		return c.sendListFromJSON(args[0], source, opts)
+	}
 	if len(args) < 9 {
-		c.Logger.Errorf("Usage: sendlist <jid> <title> <text> <footer> <button text> <section title> -- <row title> <row description> / ...")
-		return nil
+		return nil, c.failf("Usage: sendlist <jid> <title> <text> <footer> <button text> <section title> -- <row title> <row description> / ... [--reply-to <message ID>]\n       sendlist <jid> <@file.json|JSON> [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 
 	if args[6] != "--" {
-		c.Logger.Errorf("Missing '--' separator")
-		return nil
+		return nil, c.failf("Missing '--' separator")
 	}
 
 	sectionTitle := args[5]
 	items := args[7:]
 	if len(items)%3 != 0 {
-		c.Logger.Errorf("Invalid number of items; each item should be in the format: <title> <description> /")
-		return nil
+		return nil, c.failf("Invalid number of items; each item should be in the format: <title> <description> /")
 	}
 
 	rows := []*waProto.ListMessage_Row{}
 	for i := 0; i < len(items); i += 3 {
 		if items[i+2] != "/" {
-			c.Logger.Errorf("Missing '/' separator after item %d", i/3+1)
-			return nil
+			return nil, c.failf("Missing '/' separator after item %d", i/3+1)
 		}
 		row := &waProto.ListMessage_Row{
 			RowId:       proto.String(fmt.Sprintf("id%d", i/3+1)),
@@ -97,30 +103,60 @@ func (c *Client) handleSendListCommand(args []string) error {
 		},
 	}
 
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
-		c.Logger.Errorf("Error sending list message: %v", err)
-	} else {
-		c.Logger.Infof("List message sent (server timestamp: %s)", resp.Timestamp)
+		return nil, c.failf("Error sending list message: %v", err)
 	}
-	return nil
+	c.Logger.Infof("List message sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
 }
 
-func (c *Client) handleSendPollCommand(args []string) error {
+// sendListFromJSON sends a list message described by inline JSON or @file.json, which
+// unlike the positional syntax supports several sections and custom row IDs.
+func (c *Client) sendListFromJSON(jid, source string, opts *SendOptions) (*CommandResult, error) {
+	recipient, ok := utils.ParseJID(jid)
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", jid)
+	}
+	spec, err := loadListSpec(source)
+	if err != nil {
+		return nil, c.failf("Failed to load list: %v", err)
+	}
+	if err = spec.Validate(); err != nil {
+		return nil, c.failf("Invalid list: %v", err)
+	}
+	msg := spec.Message()
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
+	if err != nil {
+		return nil, c.failf("Error sending list message: %v", err)
+	}
+	c.Logger.Infof("List message sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
+}
+
+func (c *Client) handleSendPollCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
 	if len(args) < 4 {
-		c.Logger.Errorf("Usage: sendpoll <jid> <question> -- <option 1> / <option 2> / ...")
-		return nil
+		return nil, c.failf("Usage: sendpoll <jid> <question> -- <option 1> / <option 2> / ... [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 
 	remainingArgs := strings.Join(args[1:], " ")
 	question, optionsStr, found := strings.Cut(remainingArgs, "--")
 	if !found {
-		c.Logger.Errorf("Missing '--' separator")
-		return nil
+		return nil, c.failf("Missing '--' separator")
 	}
 	question = strings.TrimSpace(question)
 	options := strings.Split(optionsStr, "/")
@@ -129,23 +165,91 @@ func (c *Client) handleSendPollCommand(args []string) error {
 	}
 
 	msg := c.WAClient.BuildPollCreation(question, options, 0)
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
-		c.Logger.Errorf("Error sending poll message: %v", err)
-	} else {
-		c.Logger.Infof("Poll message sent (server timestamp: %s)", resp.Timestamp)
+		return nil, c.failf("Error sending poll message: %v", err)
+	}
+	c.Logger.Infof("Poll message sent (server timestamp: %s)", resp.Timestamp)
+	err = c.Polls.SavePoll(resp.ID, recipient, question, options)
+	if err != nil {
+		c.Logger.Errorf("Failed to save poll %s, votes on it won't be resolved: %v", resp.ID, err)
 	}
-	return nil
+	return sendResult(resp), nil
 }
 
-func (c *Client) handleSendLinkCommand(args []string) error {
-	if len(args) < 2 {
-		c.Logger.Errorf("Usage: sendlink <jid> <url/link> [text]")
+func (c *Client) handlePollResultsCommand(args []string) (*CommandResult, error) {
+	if len(args) < 1 {
+		return nil, c.failf("Usage: pollresults <message ID>")
+	}
+	results, err := c.Polls.GetResults(args[0])
+	if err != nil {
+		return nil, c.failf("Failed to get poll results: %v", err)
+	} else if results == nil {
+		return nil, c.failf("Unknown poll: %s", args[0])
+	}
+	c.Logger.Infof("Poll %s in %s: %s", results.MessageID, results.Chat, results.Question)
+	for _, option := range results.Options {
+		c.Logger.Infof("* %s: %d votes", option.Option, option.Votes)
+	}
+	return &CommandResult{Data: results}, nil
+}
+
+// recordPollVote decrypts a vote on one of our polls and stores it as the voter's
+// current selection. It returns the vote for the webhook, or nil if it couldn't be recorded.
+func (c *Client) recordPollVote(evt *events.Message, pollUpdate *waProto.PollUpdateMessage) *WebhookPollVote {
+	pollID := pollUpdate.GetPollCreationMessageKey().GetId()
+	decrypted, err := c.WAClient.DecryptPollVote(evt)
+	if err != nil {
+		c.Logger.Errorf("Failed to decrypt vote: %v", err)
 		return nil
 	}
+
+	question, options, err := c.Polls.GetPoll(pollID)
+	if err != nil {
+		c.Logger.Errorf("Failed to read question data: %v", err)
+		return nil
+	} else if question == "" {
+		c.Logger.Warnf("Received vote for unknown poll %s", pollID)
+		return nil
+	}
+
+	selectedHashes := make([]string, len(decrypted.SelectedOptions))
+	selectedOptions := make([]interface{}, len(decrypted.SelectedOptions))
+	for i, selectedOption := range decrypted.SelectedOptions {
+		selectedHashes[i] = fmt.Sprintf("%x", selectedOption)
+		option, ok := options[selectedHashes[i]]
+		if !ok {
+			c.Logger.Errorf("Failed to read option data: unknown option %s", selectedHashes[i])
+			return nil
+		}
+		selectedOptions[i] = option
+	}
+
+	err = c.Polls.SetVotes(pollID, evt.Info.Sender, selectedHashes, evt.Info.Timestamp)
+	if err != nil {
+		c.Logger.Errorf("Failed to save poll vote: %v", err)
+	}
+	return &WebhookPollVote{
+		PollMessageID:   pollID,
+		Question:        question,
+		SelectedOptions: selectedOptions,
+	}
+}
+
+func (c *Client) handleSendLinkCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	if len(args) < 2 {
+		return nil, c.failf("Usage: sendlink <jid> <url/link> [text] [--reply-to <message ID>]")
+	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 
 	text := ""
@@ -184,107 +288,73 @@ func (c *Client) handleSendLinkCommand(args []string) error {
 		},
 	}
 
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	if err = c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
-		c.Logger.Errorf("Error sending link message: %v", err)
-	} else {
-		c.Logger.Infof("Link message sent (server timestamp: %s)", resp.Timestamp)
+		return nil, c.failf("Error sending link message: %v", err)
 	}
-	return nil
+	c.Logger.Infof("Link message sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
 }
 
-func (c *Client) handleSendDocumentCommand(args []string) error {
-	if len(args) < 3 {
-		c.Logger.Errorf("Usage: senddoc <jid> <document path> <document file name> [caption] [mime-type]")
-		return nil
+func (c *Client) handleSendDocumentCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	if len(args) < 2 {
+		return nil, c.failf("Usage: senddoc <jid> <document path|url|data: URI|-> [document file name] [caption] [mime-type] [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
-	data, err := os.ReadFile(args[1])
+	media, err := c.loadMedia(args[1])
 	if err != nil {
-		c.Logger.Errorf("Failed to read %s: %v", args[1], err)
-		return nil
+		return nil, c.failf("Failed to read %s: %v", args[1], err)
 	}
-	uploaded, err := c.WAClient.Upload(context.Background(), data, whatsmeow.MediaDocument)
-	if err != nil {
-		c.Logger.Errorf("Failed to upload file: %v", err)
-		return nil
+	if len(args) > 2 && args[2] != "" {
+		media.FileName = args[2]
 	}
 	caption := ""
 	if len(args) > 3 {
 		caption = args[3]
 	}
-	mimeType := http.DetectContentType(data)
 	if len(args) > 4 {
-		mimeType = args[4]
-	}
-	msg := &waProto.Message{DocumentMessage: &waProto.DocumentMessage{
-		Title:         proto.String(args[2]),
-		Caption:       proto.String(caption),
-		Url:           proto.String(uploaded.URL),
-		DirectPath:    proto.String(uploaded.DirectPath),
-		MediaKey:      uploaded.MediaKey,
-		Mimetype:      proto.String(mimeType),
-		FileEncSha256: uploaded.FileEncSHA256,
-		FileSha256:    uploaded.FileSHA256,
-		FileLength:    proto.Uint64(uint64(len(data))),
-	}}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
-	if err != nil {
-		c.Logger.Errorf("Error sending document message: %v", err)
-	} else {
-		c.Logger.Infof("Document message sent (server timestamp: %s)", resp.Timestamp)
+		media.MimeType = args[4]
 	}
-	return nil
+	return c.sendMedia(recipient, "document", media, caption, opts)
 }
 
-func (c *Client) handleSendVideoCommand(args []string) error {
+func (c *Client) handleSendVideoCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: sendvid <jid> <video path> [caption]")
-		return nil
+		return nil, c.failf("Usage: sendvid <jid> <video path|url|data: URI|-> [caption] [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
-	}
-
-	data, err := os.ReadFile(args[1])
-	if err != nil {
-		c.Logger.Errorf("Failed to read %s: %v", args[1], err)
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
-
-	thumbnail, err := createThumbnail(args[1])
+	media, err := c.loadMedia(args[1])
 	if err != nil {
-		c.Logger.Errorf("Error creating thumbnail: %v", err)
+		return nil, c.failf("Failed to read %s: %v", args[1], err)
 	}
+	return c.sendMedia(recipient, "video", media, strings.Join(args[2:], " "), opts)
+}
 
-	uploaded, err := c.WAClient.Upload(context.Background(), data, whatsmeow.MediaVideo)
+// createMediaThumbnail creates a thumbnail of media that may not be on disk.
+func createMediaThumbnail(media *MediaSource) ([]byte, error) {
+	mediaPath, cleanup, err := media.localPath()
 	if err != nil {
-		c.Logger.Errorf("Failed to upload video: %v", err)
-		return nil
-	}
-
-	msg := &waProto.Message{VideoMessage: &waProto.VideoMessage{
-		Caption:       proto.String(strings.Join(args[2:], " ")),
-		Url:           proto.String(uploaded.URL),
-		DirectPath:    proto.String(uploaded.DirectPath),
-		MediaKey:      uploaded.MediaKey,
-		Mimetype:      proto.String(http.DetectContentType(data)),
-		FileEncSha256: uploaded.FileEncSHA256,
-		FileSha256:    uploaded.FileSHA256,
-		FileLength:    proto.Uint64(uint64(len(data))),
-		JpegThumbnail: thumbnail,
-	}}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
-	if err != nil {
-		c.Logger.Errorf("Error sending video message: %v", err)
-	} else {
-		c.Logger.Infof("Video message sent (server timestamp: %s)", resp.Timestamp)
+		return nil, err
 	}
-	return nil
+	defer cleanup()
+	return createThumbnail(mediaPath)
 }
 
 func createThumbnail(mediaPath string) ([]byte, error) {
@@ -324,100 +394,213 @@ func resizeImage(img image.Image) image.Image {
 	return img
 }
 
-func (c *Client) handleSendAudioCommand(args []string) error {
+func (c *Client) handleSendAudioCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: sendaudio <jid> <audio path>")
-		return nil
+		return nil, c.failf("Usage: sendaudio <jid> <audio path|url|data: URI|-> [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
-
-	data, err := os.ReadFile(args[1])
+	media, err := c.loadMedia(args[1])
 	if err != nil {
-		c.Logger.Errorf("Failed to read %s: %v", args[1], err)
-		return nil
+		return nil, c.failf("Failed to read %s: %v", args[1], err)
 	}
+	return c.sendMedia(recipient, "audio", media, "", opts)
+}
 
-	uploaded, err := c.WAClient.Upload(context.Background(), data, whatsmeow.MediaAudio)
-	if err != nil {
-		c.Logger.Errorf("Failed to upload audio: %v", err)
-		return nil
+// voiceWaveformSamples is the number of samples in the waveform of a voice note.
+const voiceWaveformSamples = 64
+
+// convertToOpus transcodes an audio file to mono OGG/Opus, the format of WhatsApp voice notes.
+func convertToOpus(audioPath string) ([]byte, error) {
+	outBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	cmd := exec.Command("ffmpeg", "-y", "-i", audioPath, "-vn", "-ac", "1", "-ar", "48000", "-c:a", "libopus", "-b:a", "32k", "-application", "voip", "-f", "ogg", "pipe:1")
+	cmd.Stdout = outBuf
+	cmd.Stderr = errBuf
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
 	}
+	return outBuf.Bytes(), nil
+}
 
-	msg := &waProto.Message{AudioMessage: &waProto.AudioMessage{
-		Url:           proto.String(uploaded.URL),
-		DirectPath:    proto.String(uploaded.DirectPath),
-		MediaKey:      uploaded.MediaKey,
-		Mimetype:      proto.String(http.DetectContentType(data)),
-		FileEncSha256: uploaded.FileEncSHA256,
-		FileSha256:    uploaded.FileSHA256,
-		FileLength:    proto.Uint64(uint64(len(data))),
-	}}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
-	if err != nil {
-		c.Logger.Errorf("Error sending audio message: %v", err)
-	} else {
-		c.Logger.Infof("Audio message sent (server timestamp: %s)", resp.Timestamp)
+// audioWaveform decodes an audio file and returns its duration in seconds along
+// with a waveform of voiceWaveformSamples values between 0 and 100.
+func audioWaveform(audioPath string) (uint32, []byte, error) {
+	const sampleRate = 8000
+	outBuf := new(bytes.Buffer)
+	cmd := exec.Command("ffmpeg", "-i", audioPath, "-vn", "-ac", "1", "-ar", strconv.Itoa(sampleRate), "-f", "s16le", "pipe:1")
+	cmd.Stdout = outBuf
+	if err := cmd.Run(); err != nil {
+		return 0, nil, err
+	}
+	pcm := outBuf.Bytes()
+	sampleCount := len(pcm) / 2
+	seconds := uint32((sampleCount + sampleRate - 1) / sampleRate)
+
+	// Average the amplitude over equal chunks, then scale so the loudest chunk is 100
+	levels := make([]float64, voiceWaveformSamples)
+	var loudest float64
+	for i := range levels {
+		start := i * sampleCount / voiceWaveformSamples
+		end := (i + 1) * sampleCount / voiceWaveformSamples
+		if end <= start {
+			continue
+		}
+		var sum float64
+		for j := start; j < end; j++ {
+			sample := int16(uint16(pcm[2*j]) | uint16(pcm[2*j+1])<<8)
+			if sample < 0 {
+				sum -= float64(sample)
+			} else {
+				sum += float64(sample)
+			}
+		}
+		levels[i] = sum / float64(end-start)
+		if levels[i] > loudest {
+			loudest = levels[i]
+		}
+	}
+	waveform := make([]byte, voiceWaveformSamples)
+	if loudest > 0 {
+		for i, level := range levels {
+			waveform[i] = byte(level / loudest * 100)
+		}
 	}
-	return nil
+	return seconds, waveform, nil
 }
 
-func (c *Client) handleSendImageCommand(args []string) error {
+func (c *Client) handleSendVoiceCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: sendimg <jid> <image path> [caption]")
-		return nil
+		return nil, c.failf("Usage: sendvoice <jid> <audio path|url|data: URI|-> [--reply-to <message ID>]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
-	data, err := os.ReadFile(args[1])
+	media, err := c.loadMedia(args[1])
 	if err != nil {
-		c.Logger.Errorf("Failed to read %s: %v", args[1], err)
-		return nil
+		return nil, c.failf("Failed to read %s: %v", args[1], err)
 	}
+	return c.sendMedia(recipient, "voice", media, "", opts)
+}
 
-	thumbnail, err := createThumbnail(args[1])
+func (c *Client) handleSendImageCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
 	if err != nil {
-		c.Logger.Errorf("Error creating thumbnail: %v", err)
+		return nil, c.failf("%v", err)
+	}
+	if len(args) < 2 {
+		return nil, c.failf("Usage: sendimg <jid> <image path|url|data: URI|-> [caption] [--reply-to <message ID>]")
 	}
+	recipient, ok := utils.ParseJID(args[0])
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", args[0])
+	}
+	media, err := c.loadMedia(args[1])
+	if err != nil {
+		return nil, c.failf("Failed to read %s: %v", args[1], err)
+	}
+	return c.sendMedia(recipient, "image", media, strings.Join(args[2:], " "), opts)
+}
 
-	uploaded, err := c.WAClient.Upload(context.Background(), data, whatsmeow.MediaImage)
+// stickerSize is the width and height of WhatsApp stickers.
+const stickerSize = 512
+
+// isAnimatedMedia reports whether r holds a video or a GIF with more than one frame.
+func isAnimatedMedia(r io.Reader) bool {
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(r, head)
+	mimeType := http.DetectContentType(head[:n])
+	if strings.HasPrefix(mimeType, "video/") {
+		return true
+	} else if mimeType == "image/gif" {
+		decoded, err := gif.DecodeAll(io.MultiReader(bytes.NewReader(head[:n]), r))
+		return err == nil && len(decoded.Image) > 1
+	}
+	return false
+}
+
+// checkStickerSource reports whether media is animated. It fails for media that is
+// neither animated nor an image, to catch unsupported files before ffmpeg does.
+func checkStickerSource(media *MediaSource) (bool, error) {
+	reader, err := media.open()
 	if err != nil {
-		c.Logger.Errorf("Failed to upload image: %v", err)
-		return nil
+		return false, err
+	}
+	animated := isAnimatedMedia(reader)
+	reader.Close()
+	if animated {
+		return true, nil
+	}
+	if reader, err = media.open(); err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	if _, _, err = image.DecodeConfig(reader); err != nil {
+		return false, fmt.Errorf("unsupported sticker source %s: %w", media.FileName, err)
 	}
+	return false, nil
+}
 
-	msg := &waProto.Message{ImageMessage: &waProto.ImageMessage{
-		Caption:       proto.String(strings.Join(args[2:], " ")),
-		Url:           proto.String(uploaded.URL),
-		DirectPath:    proto.String(uploaded.DirectPath),
-		MediaKey:      uploaded.MediaKey,
-		Mimetype:      proto.String(http.DetectContentType(data)),
-		FileEncSha256: uploaded.FileEncSHA256,
-		FileSha256:    uploaded.FileSHA256,
-		FileLength:    proto.Uint64(uint64(len(data))),
-		JpegThumbnail: thumbnail,
-	}}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
-	if err != nil {
-		c.Logger.Errorf("Error sending image message: %v", err)
+// convertToSticker converts an image, GIF or video to a 512x512 WebP with a transparent
+// border, keeping the aspect ratio. Animated sources are limited to 10 seconds.
+func convertToSticker(mediaPath string, animated bool) ([]byte, error) {
+	filter := fmt.Sprintf("scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=0x00000000,format=rgba", stickerSize)
+	cmdArgs := []string{"-y", "-i", mediaPath, "-an", "-c:v", "libwebp", "-q:v", "75"}
+	if animated {
+		cmdArgs = append(cmdArgs, "-vf", "fps=15,"+filter, "-loop", "0", "-t", "10")
 	} else {
-		c.Logger.Infof("Image message sent (server timestamp: %s)", resp.Timestamp)
+		cmdArgs = append(cmdArgs, "-vf", filter, "-frames:v", "1")
+	}
+	cmdArgs = append(cmdArgs, "-f", "webp", "pipe:1")
+
+	outBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	cmd := exec.Command("ffmpeg", cmdArgs...)
+	cmd.Stdout = outBuf
+	cmd.Stderr = errBuf
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
 	}
-	return nil
+	return outBuf.Bytes(), nil
 }
 
-func (c *Client) handleReactCommand(args []string) error {
+func (c *Client) handleSendStickerCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	if len(args) < 2 {
+		return nil, c.failf("Usage: sendsticker <jid> <image or video path|url|data: URI|-> [--reply-to <message ID>]")
+	}
+	recipient, ok := utils.ParseJID(args[0])
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", args[0])
+	}
+	media, err := c.loadMedia(args[1])
+	if err != nil {
+		return nil, c.failf("Failed to read %s: %v", args[1], err)
+	}
+	return c.sendMedia(recipient, "sticker", media, "", opts)
+}
+
+func (c *Client) handleReactCommand(args []string) (*CommandResult, error) {
 	if len(args) < 3 {
-		c.Logger.Errorf("Usage: react <jid> <message ID> <reaction>")
-		return nil
+		return nil, c.failf("Usage: react <jid> <message ID> <reaction>")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	messageID := args[1]
 	fromMe := false
@@ -440,81 +623,154 @@ func (c *Client) handleReactCommand(args []string) error {
 			SenderTimestampMs: proto.Int64(time.Now().UnixMilli()),
 		},
 	}
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
-		c.Logger.Errorf("Error sending reaction: %v", err)
-	} else {
-		c.Logger.Infof("Reaction sent (server timestamp: %s)", resp.Timestamp)
+		return nil, c.failf("Error sending reaction: %v", err)
 	}
-	return nil
+	c.Logger.Infof("Reaction sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
 }
 
-func (c *Client) handleRevokeCommand(args []string) error {
+func (c *Client) handleRevokeCommand(args []string) (*CommandResult, error) {
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: revoke <jid> <message ID>")
-		return nil
+		return nil, c.failf("Usage: revoke <jid> <message ID>")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 	messageID := args[1]
 	msg := c.WAClient.BuildRevocation(recipient, types.EmptyJID, messageID)
-	resp, err := c.WAClient.SendMessage(context.Background(), recipient, msg)
+	resp, err := c.sendMessage(recipient, msg)
 	if err != nil {
-		c.Logger.Errorf("Error sending revocation: %v", err)
-	} else {
-		c.Logger.Infof("Revocation sent (server timestamp: %s)", resp.Timestamp)
+		return nil, c.failf("Error sending revocation: %v", err)
+	}
+	c.Logger.Infof("Revocation sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
+}
+
+// editedContent builds the new content of an edited message. Captioned media keeps
+// its media if the original is in the recent message cache. Media that is only in the
+// history can't be edited, since the history doesn't keep the media keys needed to resend it.
+func (c *Client) editedContent(messageID, text string) (*waProto.Message, error) {
+	if recent := c.getRecentMessage(messageID); recent != nil {
+		content := proto.Clone(recent.Message).(*waProto.Message)
+		content.MessageContextInfo = nil
+		if field := textField(content); field != nil {
+			*field = proto.String(text)
+			return content, nil
+		}
+	} else if stored, err := c.History.GetMessage(messageID); err == nil && stored != nil {
+		switch stored.Type {
+		case "image", "video", "document":
+			return nil, fmt.Errorf("%s %s is no longer in the recent message cache, so its caption can't be edited", stored.Type, messageID)
+		}
+	}
+	return &waProto.Message{Conversation: proto.String(text)}, nil
+}
+
+func (c *Client) handleEditCommand(args []string) (*CommandResult, error) {
+	if len(args) < 3 {
+		return nil, c.failf("Usage: edit <jid> <message ID> <new text>")
+	}
+	recipient, ok := utils.ParseJID(args[0])
+	if !ok {
+		return nil, c.failf("Invalid JID: %s", args[0])
+	}
+	messageID := args[1]
+	content, err := c.editedContent(messageID, strings.Join(args[2:], " "))
+	if err != nil {
+		return nil, c.failf("Failed to edit message: %v", err)
+	}
+	c.applyMentions(content)
+	msg := c.WAClient.BuildEdit(recipient, messageID, content)
+	resp, err := c.sendMessage(recipient, msg)
+	if err != nil {
+		return nil, c.failf("Error sending edit: %v", err)
 	}
-	return nil
+	c.Logger.Infof("Edit sent (server timestamp: %s)", resp.Timestamp)
+	return sendResult(resp), nil
 }
 
-func (c *Client) handleMarkReadCommand(args []string) error {
+func (c *Client) handleMarkReadCommand(args []string) (*CommandResult, error) {
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: markread <jid> <message ID 1> [message ID X]")
-		return nil
+		return nil, c.failf("Usage: markread <jid> <message ID 1> [message ID X]")
 	}
 	recipient, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	}
 
 	messageIDs := args[1:]
 
 	err := c.WAClient.MarkRead(messageIDs, time.Now(), recipient, types.EmptyJID)
 	if err != nil {
-		c.Logger.Errorf("Error sending mark as read: %v", err)
-	} else {
-		c.Logger.Infof("Mark as read sent")
+		return nil, c.failf("Error sending mark as read: %v", err)
 	}
-	return nil
+	c.Logger.Infof("Mark as read sent")
+	return nil, nil
 }
 
-func (c *Client) handleBatchMessageGroupMembersCommand(args []string) error {
+// handleBatchMessageGroupMembersCommand sends a text to every member of a group as a rate-limited bulk job.
+func (c *Client) handleBatchMessageGroupMembersCommand(args []string) (*CommandResult, error) {
 	if len(args) < 2 {
-		c.Logger.Errorf("Usage: batchsendgroupmembers <group jid> <text>")
-		return nil
+		return nil, c.failf("Usage: batchmessagegroupmembers <group jid> <text>")
+	}
+	return c.handleBulkSendCommand(append([]string{args[0], "--"}, args[1:]...))
+}
+
+// handleTagAllCommand sends a text to a group that mentions every other participant.
+func (c *Client) handleTagAllCommand(args []string) (*CommandResult, error) {
+	args, opts, err := parseSendOptions(args)
+	if err != nil {
+		return nil, c.failf("%v", err)
+	}
+	if len(args) < 2 {
+		return nil, c.failf("Usage: tagall <group jid> <text> [--reply-to <message ID>]")
 	}
 	group, ok := utils.ParseJID(args[0])
 	if !ok {
-		return nil
+		return nil, c.failf("Invalid JID: %s", args[0])
 	} else if group.Server != types.GroupServer {
-		c.Logger.Errorf("Input must be a group JID (@%s)", types.GroupServer)
-		return nil
+		return nil, c.failf("Input must be a group JID (@%s)", types.GroupServer)
 	}
-	resp, err := c.WAClient.GetGroupInfo(group)
+	info, err := c.getGroupInfo(group)
 	if err != nil {
-		c.Logger.Errorf("Failed to get group info: %v", err)
-		return nil
+		return nil, c.failf("Failed to get group info: %v", err)
 	}
-	for _, participant := range resp.Participants {
-		participantJID := participant.JID
-		if participantJID == c.WAClient.Store.ID {
+
+	var mentions []string
+	var tags []string
+	for _, participant := range info.Participants {
+		if c.WAClient.Store.ID != nil && participant.JID.User == c.WAClient.Store.ID.User {
 			continue
 		}
-		newArgs := []string{participantJID.String()}
-		newArgs = append(newArgs, args[1:]...)
-		c.handleSendCommand(newArgs)
+		mentions = append(mentions, participant.JID.String())
+		tags = append(tags, "@"+participant.JID.User)
+	}
+	if len(mentions) == 0 {
+		return nil, c.failf("No other participants in %s", group)
+	}
+
+	// Only the typed text is searched for mentions. The tags are mentioned by their
+	// JIDs as is, since the user part of an @lid JID would be taken for a phone number.
+	text := strings.Join(args[1:], " ")
+	var textMentions []string
+	if !opts.NoMentions {
+		text, textMentions = c.resolveMentions(text)
+		opts.NoMentions = true
+	}
+	text += "\n\n" + strings.Join(tags, " ")
+	msg := &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String(text)}}
+	addMentions(msg, textMentions)
+	addMentions(msg, mentions)
+	if err = c.applySendOptions(group, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(group, msg)
+	if err != nil {
+		return nil, c.failf("Error sending message: %v", err)
 	}
-	return nil
+	c.Logger.Infof("Tagged %d participants (server timestamp: %s)", len(mentions), resp.Timestamp)
+	return sendResult(resp), nil
 }
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// groupLoadTimeout is how long lookups wait for the joined groups to be loaded on connect.
+const groupLoadTimeout = 10 * time.Second
+
+// groupFetchRetry is how long a group that failed to load isn't fetched again.
+const groupFetchRetry = time.Minute
+
+var errGroupUnavailable = errors.New("group info failed to load recently")
+
+// GroupCache keeps the info of the joined groups. It is loaded on connect and kept
+// current from group events, so lookups rarely need to query the server.
+type GroupCache struct {
+	lock     sync.RWMutex
+	groups   map[types.JID]*types.GroupInfo
+	loaded   chan struct{}
+	loadOnce sync.Once
+
+	fetchLock sync.Mutex
+	fetching  map[types.JID]*groupFetch
+	failed    map[types.JID]time.Time
+}
+
+// groupFetch is a load of a single group that other lookups of it wait for.
+type groupFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewGroupCache() *GroupCache {
+	return &GroupCache{
+		groups:   make(map[types.JID]*types.GroupInfo),
+		loaded:   make(chan struct{}),
+		fetching: make(map[types.JID]*groupFetch),
+		failed:   make(map[types.JID]time.Time),
+	}
+}
+
+// Load replaces the cache with the given groups.
+func (gc *GroupCache) Load(groups []*types.GroupInfo) {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	gc.groups = make(map[types.JID]*types.GroupInfo, len(groups))
+	for _, group := range groups {
+		gc.groups[group.JID] = group
+	}
+	gc.markLoaded()
+}
+
+// markLoaded stops lookups from waiting for the first load, whether or not it succeeded.
+func (gc *GroupCache) markLoaded() {
+	gc.loadOnce.Do(func() { close(gc.loaded) })
+}
+
+// WaitLoaded waits up to timeout for the first Load and reports whether it happened.
+func (gc *GroupCache) WaitLoaded(timeout time.Duration) bool {
+	select {
+	case <-gc.loaded:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Fetch loads and caches a group that isn't cached. Concurrent fetches of the same
+// group share a single load, and a group that failed to load isn't loaded again for
+// groupFetchRetry.
+func (gc *GroupCache) Fetch(jid types.JID, load func() (*types.GroupInfo, error)) (*types.GroupInfo, error) {
+	gc.fetchLock.Lock()
+	if failedAt, ok := gc.failed[jid]; ok && time.Since(failedAt) < groupFetchRetry {
+		gc.fetchLock.Unlock()
+		return nil, errGroupUnavailable
+	}
+	fetch, ok := gc.fetching[jid]
+	if !ok {
+		fetch = &groupFetch{done: make(chan struct{})}
+		gc.fetching[jid] = fetch
+	}
+	gc.fetchLock.Unlock()
+
+	if ok {
+		<-fetch.done
+	} else {
+		info, err := load()
+		if err == nil {
+			gc.Put(info)
+		}
+		gc.fetchLock.Lock()
+		delete(gc.fetching, jid)
+		if err != nil {
+			gc.failed[jid] = time.Now()
+		} else {
+			delete(gc.failed, jid)
+		}
+		fetch.err = err
+		gc.fetchLock.Unlock()
+		close(fetch.done)
+	}
+	if fetch.err != nil {
+		return nil, fetch.err
+	}
+	return gc.Get(jid), nil
+}
+
+// Get returns a copy of the cached info of a group, or nil if it isn't cached.
+func (gc *GroupCache) Get(jid types.JID) *types.GroupInfo {
+	gc.lock.RLock()
+	defer gc.lock.RUnlock()
+	group, ok := gc.groups[jid]
+	if !ok {
+		return nil
+	}
+	info := *group
+	info.Participants = append([]types.GroupParticipant(nil), group.Participants...)
+	return &info
+}
+
+func (gc *GroupCache) Put(group *types.GroupInfo) {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	gc.groups[group.JID] = group
+}
+
+func (gc *GroupCache) Remove(jid types.JID) {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	delete(gc.groups, jid)
+}
+
+// Apply updates a cached group with the changes of a group info event. It returns
+// false if the group isn't cached, in which case it should be fetched instead.
+func (gc *GroupCache) Apply(evt *events.GroupInfo) bool {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	group, ok := gc.groups[evt.JID]
+	if !ok {
+		return false
+	}
+	if evt.Name != nil {
+		group.GroupName = *evt.Name
+	}
+	if evt.Topic != nil {
+		group.GroupTopic = *evt.Topic
+	}
+	if evt.Locked != nil {
+		group.GroupLocked = *evt.Locked
+	}
+	if evt.Announce != nil {
+		group.GroupAnnounce = *evt.Announce
+	}
+	if evt.Ephemeral != nil {
+		group.GroupEphemeral = *evt.Ephemeral
+	}
+	for _, jid := range evt.Join {
+		found := false
+		for _, participant := range group.Participants {
+			if participant.JID == jid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			group.Participants = append(group.Participants, types.GroupParticipant{JID: jid})
+		}
+	}
+	if len(evt.Leave) > 0 {
+		left := make(map[types.JID]bool, len(evt.Leave))
+		for _, jid := range evt.Leave {
+			left[jid] = true
+		}
+		participants := group.Participants[:0]
+		for _, participant := range group.Participants {
+			if !left[participant.JID] {
+				participants = append(participants, participant)
+			}
+		}
+		group.Participants = participants
+	}
+	setAdmin := func(jids []types.JID, isAdmin bool) {
+		for _, jid := range jids {
+			for i := range group.Participants {
+				if group.Participants[i].JID == jid {
+					group.Participants[i].IsAdmin = isAdmin
+				}
+			}
+		}
+	}
+	setAdmin(evt.Promote, true)
+	setAdmin(evt.Demote, false)
+	if evt.ParticipantVersionID != "" {
+		group.ParticipantVersionID = evt.ParticipantVersionID
+	}
+	return true
+}
+
+// refreshGroups reloads the group cache from the server.
+func (c *Client) refreshGroups() {
+	groups, err := c.WAClient.GetJoinedGroups()
+	if err != nil {
+		c.Logger.Warnf("Failed to get joined groups: %v", err)
+		c.Groups.markLoaded()
+		return
+	}
+	c.Groups.Load(groups)
+	c.Logger.Debugf("Loaded %d groups", len(groups))
+}
+
+// getGroupInfo returns the info of a group from the cache, fetching and caching it if needed.
+func (c *Client) getGroupInfo(jid types.JID) (*types.GroupInfo, error) {
+	if info := c.Groups.Get(jid); info != nil {
+		return info, nil
+	}
+	// Messages from the offline backlog can arrive before the joined groups are loaded
+	if c.Groups.WaitLoaded(groupLoadTimeout) {
+		if info := c.Groups.Get(jid); info != nil {
+			return info, nil
+		}
+	}
+	return c.Groups.Fetch(jid, func() (*types.GroupInfo, error) {
+		info, err := c.WAClient.GetGroupInfo(jid)
+		if err != nil {
+			c.Logger.Warnf("Failed to get info of group %s: %v", jid, err)
+		}
+		return info, err
+	})
+}
+
+// groupName returns the name of a group, or an empty string if it can't be found.
+// Failures are logged once per fetch by getGroupInfo.
+func (c *Client) groupName(jid types.JID) string {
+	info, err := c.getGroupInfo(jid)
+	if err != nil {
+		return ""
+	}
+	return info.Name
+}
+
+// newGroupEvent returns a webhook event about a change of a group.
+func (c *Client) newGroupEvent(eventType string, jid types.JID, change *WebhookGroupChange) *WebhookEvent {
+	event := c.newWebhookEvent(eventType)
+	event.Chat = &WebhookChat{JID: jid.String(), IsGroup: true, GroupName: c.groupName(jid)}
+	event.Group = change
+	return event
+}
+
+func jidStrings(jids []types.JID) []string {
+	strs := make([]string, len(jids))
+	for i, jid := range jids {
+		strs[i] = jid.String()
+	}
+	return strs
+}
+
+func participantJIDs(participants []types.GroupParticipant) []string {
+	jids := make([]string, len(participants))
+	for i, participant := range participants {
+		jids[i] = participant.JID.String()
+	}
+	return jids
+}
+
+// handleJoinedGroup caches a group we were added to or created and reports it in --mode both.
+func (c *Client) handleJoinedGroup(evt *events.JoinedGroup) {
+	info := evt.GroupInfo
+	c.Groups.Put(&info)
+	c.Logger.Infof("Joined group %s (%s), reason: %q", info.JID, info.Name, evt.Reason)
+	if c.Config.Mode != "both" {
+		return
+	}
+	event := c.newGroupEvent("group_joined", info.JID, &WebhookGroupChange{
+		Reason:       evt.Reason,
+		Participants: participantJIDs(info.Participants),
+	})
+	c.sendWebhookEvent(event)
+}
+
+// handleGroupInfo applies a group change to the cache and reports it in --mode both.
+func (c *Client) handleGroupInfo(evt *events.GroupInfo) {
+	if !c.Groups.Apply(evt) {
+		if _, err := c.getGroupInfo(evt.JID); err != nil {
+			c.Logger.Warnf("Failed to get info of changed group %s: %v", evt.JID, err)
+		}
+	}
+	c.Logger.Infof("Group %s changed: %+v", evt.JID, evt)
+	if c.Config.Mode == "both" {
+		c.reportGroupChanges(evt)
+	}
+
+	// Forget groups we were removed from or that were deleted, after reporting them by name
+	if evt.Delete != nil {
+		c.Groups.Remove(evt.JID)
+		return
+	}
+	for _, jid := range evt.Leave {
+		if c.WAClient.Store.ID != nil && jid.User == c.WAClient.Store.ID.User {
+			c.Groups.Remove(evt.JID)
+			break
+		}
+	}
+}
+
+// reportGroupChanges sends a webhook event for every part of a group change.
+func (c *Client) reportGroupChanges(evt *events.GroupInfo) {
+	actor := ""
+	if evt.Sender != nil {
+		actor = evt.Sender.ToNonAD().String()
+	}
+	var changes []*WebhookEvent
+	add := func(eventType string, change *WebhookGroupChange) {
+		change.Actor = actor
+		event := c.newGroupEvent(eventType, evt.JID, change)
+		event.Timestamp = evt.Timestamp
+		changes = append(changes, event)
+	}
+	if evt.Name != nil {
+		add("group_subject_changed", &WebhookGroupChange{Name: evt.Name.Name})
+	}
+	if evt.Topic != nil {
+		add("group_description_changed", &WebhookGroupChange{Topic: evt.Topic.Topic})
+	}
+	if evt.Locked != nil {
+		add("group_settings_changed", &WebhookGroupChange{Setting: "locked", Enabled: evt.Locked.IsLocked})
+	}
+	if evt.Announce != nil {
+		add("group_settings_changed", &WebhookGroupChange{Setting: "announce", Enabled: evt.Announce.IsAnnounce})
+	}
+	if evt.Ephemeral != nil {
+		add("group_settings_changed", &WebhookGroupChange{Setting: "ephemeral", Enabled: evt.Ephemeral.IsEphemeral})
+	}
+	if evt.NewInviteLink != nil {
+		add("group_invite_link_changed", &WebhookGroupChange{InviteLink: *evt.NewInviteLink})
+	}
+	if len(evt.Join) > 0 {
+		add("group_participants_changed", &WebhookGroupChange{Action: "join", Participants: jidStrings(evt.Join), Reason: evt.JoinReason})
+	}
+	if len(evt.Leave) > 0 {
+		add("group_participants_changed", &WebhookGroupChange{Action: "leave", Participants: jidStrings(evt.Leave)})
+	}
+	if len(evt.Promote) > 0 {
+		add("group_participants_changed", &WebhookGroupChange{Action: "promote", Participants: jidStrings(evt.Promote)})
+	}
+	if len(evt.Demote) > 0 {
+		add("group_participants_changed", &WebhookGroupChange{Action: "demote", Participants: jidStrings(evt.Demote)})
+	}
+	if evt.Delete != nil {
+		add("group_deleted", &WebhookGroupChange{Reason: evt.Delete.DeleteReason})
+	}
+	for _, event := range changes {
+		c.sendWebhookEvent(event)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestGroupCacheApply(t *testing.T) {
+	group := types.NewJID("999", types.GroupServer)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	carol := types.NewJID("333", types.HiddenUserServer)
+	newGroup := func() *types.GroupInfo {
+		return &types.GroupInfo{
+			JID:          group,
+			GroupName:    types.GroupName{Name: "Old name"},
+			Participants: []types.GroupParticipant{{JID: alice, IsAdmin: true}, {JID: bob}},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		evt          *events.GroupInfo
+		groupName    string
+		participants []types.GroupParticipant
+	}{
+		{
+			name:         "rename",
+			evt:          &events.GroupInfo{JID: group, Name: &types.GroupName{Name: "New name"}},
+			groupName:    "New name",
+			participants: []types.GroupParticipant{{JID: alice, IsAdmin: true}, {JID: bob}},
+		},
+		{
+			name:         "join",
+			evt:          &events.GroupInfo{JID: group, Join: []types.JID{carol, bob}},
+			groupName:    "Old name",
+			participants: []types.GroupParticipant{{JID: alice, IsAdmin: true}, {JID: bob}, {JID: carol}},
+		},
+		{
+			name:         "leave",
+			evt:          &events.GroupInfo{JID: group, Leave: []types.JID{alice}},
+			groupName:    "Old name",
+			participants: []types.GroupParticipant{{JID: bob}},
+		},
+		{
+			name:         "promote and demote",
+			evt:          &events.GroupInfo{JID: group, Promote: []types.JID{bob}, Demote: []types.JID{alice}},
+			groupName:    "Old name",
+			participants: []types.GroupParticipant{{JID: alice}, {JID: bob, IsAdmin: true}},
+		},
+		{
+			name:         "join and promote",
+			evt:          &events.GroupInfo{JID: group, Join: []types.JID{carol}, Promote: []types.JID{carol}},
+			groupName:    "Old name",
+			participants: []types.GroupParticipant{{JID: alice, IsAdmin: true}, {JID: bob}, {JID: carol, IsAdmin: true}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewGroupCache()
+			cache.Load([]*types.GroupInfo{newGroup()})
+			if !cache.Apply(test.evt) {
+				t.Fatal("Apply() = false for a cached group")
+			}
+			info := cache.Get(group)
+			if info.Name != test.groupName {
+				t.Errorf("Name = %q, want %q", info.Name, test.groupName)
+			}
+			if !reflect.DeepEqual(info.Participants, test.participants) {
+				t.Errorf("Participants = %+v, want %+v", info.Participants, test.participants)
+			}
+		})
+	}
+
+	t.Run("uncached group", func(t *testing.T) {
+		cache := NewGroupCache()
+		if cache.Apply(&events.GroupInfo{JID: group, Name: &types.GroupName{Name: "New name"}}) {
+			t.Error("Apply() = true for a group that isn't cached")
+		}
+	})
+}
+
+func TestGroupCacheGetReturnsCopy(t *testing.T) {
+	group := types.NewJID("999", types.GroupServer)
+	cache := NewGroupCache()
+	cache.Put(&types.GroupInfo{JID: group, Participants: []types.GroupParticipant{{JID: types.NewJID("111", types.DefaultUserServer)}}})
+	info := cache.Get(group)
+	info.Name = "Changed"
+	info.Participants[0].IsAdmin = true
+	if cached := cache.Get(group); cached.Name != "" || cached.Participants[0].IsAdmin {
+		t.Errorf("changing the result of Get() changed the cache: %+v", cached)
+	}
+}
+
+func TestGroupCacheFetch(t *testing.T) {
+	group := types.NewJID("999", types.GroupServer)
+
+	t.Run("concurrent fetches share a load", func(t *testing.T) {
+		cache := NewGroupCache()
+		var loads atomic.Int32
+		release := make(chan struct{})
+		load := func() (*types.GroupInfo, error) {
+			loads.Add(1)
+			<-release
+			return &types.GroupInfo{JID: group, GroupName: types.GroupName{Name: "Group"}}, nil
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				info, err := cache.Fetch(group, load)
+				if err != nil || info.Name != "Group" {
+					t.Errorf("Fetch() = %+v, %v", info, err)
+				}
+			}()
+		}
+		// Give every lookup time to join the load before it finishes
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		if n := loads.Load(); n != 1 {
+			t.Errorf("group was loaded %d times, want 1", n)
+		}
+		if cache.Get(group) == nil {
+			t.Error("fetched group wasn't cached")
+		}
+	})
+
+	t.Run("failed loads are not retried at once", func(t *testing.T) {
+		cache := NewGroupCache()
+		errLoad := errors.New("rate limited")
+		loads := 0
+		load := func() (*types.GroupInfo, error) {
+			loads++
+			return nil, errLoad
+		}
+		if _, err := cache.Fetch(group, load); err != errLoad {
+			t.Fatalf("first Fetch() error = %v, want %v", err, errLoad)
+		}
+		if _, err := cache.Fetch(group, load); err != errGroupUnavailable {
+			t.Fatalf("second Fetch() error = %v, want %v", err, errGroupUnavailable)
+		}
+		if loads != 1 {
+			t.Errorf("group was loaded %d times, want 1", loads)
+		}
+
+		// Once the retry delay has passed the group is loaded again
+		cache.failed[group] = time.Now().Add(-groupFetchRetry)
+		info, err := cache.Fetch(group, func() (*types.GroupInfo, error) {
+			return &types.GroupInfo{JID: group}, nil
+		})
+		if err != nil || info == nil {
+			t.Fatalf("Fetch() after the retry delay = %+v, %v", info, err)
+		}
+	})
+}
+
+func TestGroupCacheWaitLoaded(t *testing.T) {
+	cache := NewGroupCache()
+	if cache.WaitLoaded(time.Millisecond) {
+		t.Error("WaitLoaded() = true before the first load")
+	}
+	// A failed first load also stops lookups from waiting
+	cache.markLoaded()
+	if !cache.WaitLoaded(time.Millisecond) {
+		t.Error("WaitLoaded() = false after markLoaded()")
+	}
+}
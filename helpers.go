@@ -4,10 +4,9 @@ import (
     "encoding/json"
     "fmt"
     "go.mau.fi/whatsmeow/types"
+    "strconv"
     "strings"
-    "os"
-    "path/filepath"
-    "crypto/sha256"
+    "time"
     "image"
     "image/jpeg"
     _ "image/png"
@@ -104,27 +103,23 @@ func ResizeImage(img image.Image) image.Image {
     return thumbnail
 }
 
-func SavePollQuestionAndOptions(messageID string, question string, options []string, baseDir string) error {
-    err := os.MkdirAll(filepath.Join(baseDir, ".tmp"), os.ModePerm)
-    if err != nil {
-        return fmt.Errorf("failed to create directory: %w", err)
-    }
-    err := os.WriteFile(filepath.Join(baseDir, ".tmp", "poll_question_"+messageID), []byte(question), 0644)
-    if err != nil {
-        return fmt.Errorf("failed to save poll question: %w", err)
-    }
+func MatchMimeType(data []byte) *mimemagic.MatchResult {
+    return mimemagic.MatchMagic(data)
+}
 
-    for _, option := range options {
-        sha := fmt.Sprintf("%x", sha256.Sum256([]byte(option)))
-        err := os.WriteFile(filepath.Join(baseDir, ".tmp", "poll_option_"+sha), []byte(option), 0644)
-        if err != nil {
-            return fmt.Errorf("failed to save poll option: %w", err)
-        }
+// ParseTimestamp parses a unix timestamp in seconds or an RFC3339 date.
+func ParseTimestamp(value string) (time.Time, error) {
+    if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+        return time.Unix(unix, 0), nil
     }
-
-    return nil
+    return time.Parse(time.RFC3339, value)
 }
 
-func MatchMimeType(data []byte) *mimemagic.MatchResult {
-    return mimemagic.MatchMagic(data)
+// FillTemplate replaces {{key}} placeholders in template with the given values.
+func FillTemplate(template string, values map[string]string) string {
+    pairs := make([]string, 0, len(values)*2)
+    for key, value := range values {
+        pairs = append(pairs, "{{"+key+"}}", value)
+    }
+    return strings.NewReplacer(pairs...).Replace(template)
 }
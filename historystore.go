@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MessageStore keeps a local history of sent and received messages in the same
+// database as the whatsmeow sqlstore container.
+type MessageStore struct {
+	db *sql.DB
+}
+
+// StoredMessage is a single row of the message history.
+type StoredMessage struct {
+	Chat      string    `json:"chat"`
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	FromMe    bool      `json:"from_me"`
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type"`
+	Text      string    `json:"text"`
+	MediaPath string    `json:"media_path,omitempty"`
+	QuotedID  string    `json:"quoted_id,omitempty"`
+}
+
+func NewMessageStore(db *sql.DB) *MessageStore {
+	return &MessageStore{db: db}
+}
+
+func (s *MessageStore) Upgrade() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS wahelper_messages (
+			chat_jid   TEXT    NOT NULL,
+			message_id TEXT    NOT NULL,
+			sender_jid TEXT    NOT NULL,
+			from_me    BOOLEAN NOT NULL,
+			timestamp  BIGINT  NOT NULL,
+			type       TEXT    NOT NULL,
+			text       TEXT    NOT NULL DEFAULT '',
+			media_path TEXT    NOT NULL DEFAULT '',
+			quoted_id  TEXT    NOT NULL DEFAULT '',
+			PRIMARY KEY (chat_jid, message_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS wahelper_messages_chat_timestamp ON wahelper_messages (chat_jid, timestamp)`,
+	}
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create message tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// messageContent returns the history type, the text (or caption) and the quoted message ID of msg.
+func messageContent(msg *waProto.Message) (string, string, string) {
+	switch {
+	case msg.GetConversation() != "":
+		return "text", msg.GetConversation(), ""
+	case msg.GetExtendedTextMessage() != nil:
+		ext := msg.GetExtendedTextMessage()
+		if ext.GetCanonicalUrl() != "" {
+			return "link", ext.GetText(), ext.GetContextInfo().GetStanzaId()
+		}
+		return "text", ext.GetText(), ext.GetContextInfo().GetStanzaId()
+	case msg.GetImageMessage() != nil:
+		return "image", msg.GetImageMessage().GetCaption(), msg.GetImageMessage().GetContextInfo().GetStanzaId()
+	case msg.GetVideoMessage() != nil:
+		return "video", msg.GetVideoMessage().GetCaption(), msg.GetVideoMessage().GetContextInfo().GetStanzaId()
+	case msg.GetAudioMessage() != nil:
+		return "audio", "", msg.GetAudioMessage().GetContextInfo().GetStanzaId()
+	case msg.GetDocumentMessage() != nil:
+		return "document", msg.GetDocumentMessage().GetCaption(), msg.GetDocumentMessage().GetContextInfo().GetStanzaId()
+	case msg.GetStickerMessage() != nil:
+		return "sticker", "", msg.GetStickerMessage().GetContextInfo().GetStanzaId()
+	case msg.GetLocationMessage() != nil:
+		return "location", msg.GetLocationMessage().GetName(), msg.GetLocationMessage().GetContextInfo().GetStanzaId()
+	case msg.GetLiveLocationMessage() != nil:
+		return "live_location", msg.GetLiveLocationMessage().GetCaption(), msg.GetLiveLocationMessage().GetContextInfo().GetStanzaId()
+	case msg.GetContactMessage() != nil:
+		return "contact", msg.GetContactMessage().GetDisplayName(), msg.GetContactMessage().GetContextInfo().GetStanzaId()
+	case msg.GetContactsArrayMessage() != nil:
+		return "contacts", msg.GetContactsArrayMessage().GetDisplayName(), msg.GetContactsArrayMessage().GetContextInfo().GetStanzaId()
+	case msg.GetPollCreationMessage() != nil:
+		return "poll", msg.GetPollCreationMessage().GetName(), msg.GetPollCreationMessage().GetContextInfo().GetStanzaId()
+	case msg.GetPollUpdateMessage() != nil:
+		return "poll_vote", "", msg.GetPollUpdateMessage().GetPollCreationMessageKey().GetId()
+	case msg.GetReactionMessage() != nil:
+		return "reaction", msg.GetReactionMessage().GetText(), msg.GetReactionMessage().GetKey().GetId()
+	case msg.GetListMessage() != nil:
+		return "list", msg.GetListMessage().GetDescription(), ""
+	case msg.GetListResponseMessage() != nil:
+		return "list_response", msg.GetListResponseMessage().GetTitle(), msg.GetListResponseMessage().GetContextInfo().GetStanzaId()
+	case msg.GetButtonsResponseMessage() != nil:
+		return "button_response", msg.GetButtonsResponseMessage().GetSelectedDisplayText(), msg.GetButtonsResponseMessage().GetContextInfo().GetStanzaId()
+	case msg.GetProtocolMessage().GetType() == waProto.ProtocolMessage_MESSAGE_EDIT:
+		_, text, _ := messageContent(msg.GetProtocolMessage().GetEditedMessage())
+		return "edit", text, msg.GetProtocolMessage().GetKey().GetId()
+	case msg.GetProtocolMessage() != nil:
+		return "protocol", "", msg.GetProtocolMessage().GetKey().GetId()
+	}
+	return "unknown", "", ""
+}
+
+// SaveMessage stores a sent or received message, keeping any media path already recorded for it.
+// Edits also replace the text of the message they edit.
+func (s *MessageStore) SaveMessage(evt *events.Message) error {
+	msgType, text, quotedID := messageContent(evt.Message)
+	if msgType == "edit" {
+		_, err := s.db.Exec(`UPDATE wahelper_messages SET text=$1 WHERE chat_jid=$2 AND message_id=$3`, text, evt.Info.Chat.String(), quotedID)
+		if err != nil {
+			return fmt.Errorf("failed to apply edit: %w", err)
+		}
+	}
+	_, err := s.db.Exec(`INSERT INTO wahelper_messages (chat_jid, message_id, sender_jid, from_me, timestamp, type, text, quoted_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (chat_jid, message_id) DO UPDATE SET type=excluded.type, text=excluded.text, quoted_id=excluded.quoted_id`,
+		evt.Info.Chat.String(), evt.Info.ID, evt.Info.Sender.ToNonAD().String(), evt.Info.IsFromMe,
+		evt.Info.Timestamp.Unix(), msgType, text, quotedID)
+	if err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+	return nil
+}
+
+// SetMediaPath records where the media of a message was saved.
+func (s *MessageStore) SetMediaPath(chat types.JID, messageID types.MessageID, path string) error {
+	_, err := s.db.Exec(`UPDATE wahelper_messages SET media_path=$1 WHERE chat_jid=$2 AND message_id=$3`, path, chat.String(), messageID)
+	return err
+}
+
+func scanMessages(rows *sql.Rows) ([]StoredMessage, error) {
+	defer rows.Close()
+	messages := []StoredMessage{}
+	for rows.Next() {
+		var msg StoredMessage
+		var ts int64
+		err := rows.Scan(&msg.Chat, &msg.ID, &msg.Sender, &msg.FromMe, &ts, &msg.Type, &msg.Text, &msg.MediaPath, &msg.QuotedID)
+		if err != nil {
+			return nil, err
+		}
+		msg.Timestamp = time.Unix(ts, 0)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+const messageColumns = `chat_jid, message_id, sender_jid, from_me, timestamp, type, text, media_path, quoted_id`
+
+// GetHistory returns up to limit messages of a chat older than before (if not zero), newest first.
+func (s *MessageStore) GetHistory(chat types.JID, limit int, before time.Time) ([]StoredMessage, error) {
+	beforeUnix := int64(1<<63 - 1)
+	if !before.IsZero() {
+		beforeUnix = before.Unix()
+	}
+	rows, err := s.db.Query(`SELECT `+messageColumns+` FROM wahelper_messages
+		WHERE chat_jid=$1 AND timestamp<$2 ORDER BY timestamp DESC LIMIT $3`, chat.String(), beforeUnix, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+// GetMessage returns a single stored message, or nil if it isn't in the history.
+func (s *MessageStore) GetMessage(messageID types.MessageID) (*StoredMessage, error) {
+	rows, err := s.db.Query(`SELECT `+messageColumns+` FROM wahelper_messages WHERE message_id=$1 LIMIT 1`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// likeEscaper escapes the LIKE wildcards so a search matches them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search returns up to limit messages whose text contains query (case-insensitive), newest first.
+func (s *MessageStore) Search(query string, limit int) ([]StoredMessage, error) {
+	rows, err := s.db.Query(`SELECT `+messageColumns+` FROM wahelper_messages
+		WHERE LOWER(text) LIKE '%' || LOWER($1) || '%' ESCAPE '\' ORDER BY timestamp DESC LIMIT $2`, likeEscaper.Replace(query), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// openTestDB opens an empty SQLite database that is removed after the test.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMessageStoreSearch(t *testing.T) {
+	store := NewMessageStore(openTestDB(t))
+	if err := store.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	chat := types.NewJID("123", types.DefaultUserServer)
+	texts := []string{
+		"50% off today",
+		"500 off today",
+		"file_name.txt",
+		"filename.txt",
+		`C:\path`,
+		"Hello World",
+	}
+	for i, text := range texts {
+		err := store.SaveMessage(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+				ID:            fmt.Sprintf("msg%d", i),
+				Timestamp:     time.Unix(int64(1000+i), 0),
+			},
+			Message: &waProto.Message{Conversation: proto.String(text)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"50%", []string{"50% off today"}},
+		{"file_", []string{"file_name.txt"}},
+		{`\`, []string{`C:\path`}},
+		{"hello", []string{"Hello World"}},
+		{"off today", []string{"500 off today", "50% off today"}},
+		{"%", []string{"50% off today"}},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			messages, err := store.Search(test.query, 10)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var got []string
+			for _, msg := range messages {
+				got = append(got, msg.Text)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("Search(%q) = %q, want %q", test.query, got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("Search(%q) = %q, want %q", test.query, got, test.want)
+				}
+			}
+		})
+	}
+}
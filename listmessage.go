@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Limits WhatsApp enforces on list messages.
+const (
+	listMaxSections             = 10
+	listMaxRows                 = 10
+	listMaxTitleLength          = 60
+	listMaxTextLength           = 1024
+	listMaxFooterLength         = 60
+	listMaxButtonTextLength     = 20
+	listMaxSectionTitleLength   = 24
+	listMaxRowTitleLength       = 24
+	listMaxRowDescriptionLength = 72
+	listMaxRowIDLength          = 200
+)
+
+// ListSpec is the JSON description of a list message.
+type ListSpec struct {
+	Title      string            `json:"title"`
+	Text       string            `json:"text"`
+	Footer     string            `json:"footer"`
+	ButtonText string            `json:"button_text"`
+	Sections   []ListSectionSpec `json:"sections"`
+}
+
+// ListSectionSpec is a titled group of rows in a list message.
+type ListSectionSpec struct {
+	Title string        `json:"title"`
+	Rows  []ListRowSpec `json:"rows"`
+}
+
+// ListRowSpec is a selectable row. Its ID is reported back when the row is picked.
+type ListRowSpec struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// listSource returns the @file.json or inline JSON list that follows the JID in
+// sendlist arguments, if there is one.
+func listSource(args []string) (string, bool) {
+	if len(args) == 2 && strings.HasPrefix(args[1], "@") {
+		return args[1], true
+	} else if len(args) >= 2 && strings.HasPrefix(strings.TrimSpace(args[1]), "{") {
+		// Inline JSON is split on whitespace like any other command line
+		return strings.Join(args[1:], " "), true
+	}
+	return "", false
+}
+
+// loadListSpec parses a list from inline JSON or from @file.json.
+func loadListSpec(source string) (*ListSpec, error) {
+	data := []byte(source)
+	if strings.HasPrefix(source, "@") {
+		var err error
+		data, err = os.ReadFile(source[1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	var spec ListSpec
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid list JSON: %w", err)
+	}
+	return &spec, nil
+}
+
+func checkLength(field, value string, max int, required bool) error {
+	if required && strings.TrimSpace(value) == "" {
+		return fmt.Errorf("%s is required", field)
+	} else if length := utf8.RuneCountInString(value); length > max {
+		return fmt.Errorf("%s is %d characters long, the limit is %d", field, length, max)
+	}
+	return nil
+}
+
+// Validate checks the list against WhatsApp's limits and fills in missing row IDs.
+func (spec *ListSpec) Validate() error {
+	checks := []error{
+		checkLength("title", spec.Title, listMaxTitleLength, false),
+		checkLength("text", spec.Text, listMaxTextLength, true),
+		checkLength("footer", spec.Footer, listMaxFooterLength, false),
+		checkLength("button_text", spec.ButtonText, listMaxButtonTextLength, true),
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	if len(spec.Sections) == 0 {
+		return fmt.Errorf("at least one section is required")
+	} else if len(spec.Sections) > listMaxSections {
+		return fmt.Errorf("%d sections, the limit is %d", len(spec.Sections), listMaxSections)
+	}
+
+	rowIDs := make(map[string]bool)
+	rowCount := 0
+	for i := range spec.Sections {
+		section := &spec.Sections[i]
+		err := checkLength(fmt.Sprintf("sections[%d].title", i), section.Title, listMaxSectionTitleLength, len(spec.Sections) > 1)
+		if err != nil {
+			return err
+		} else if len(section.Rows) == 0 {
+			return fmt.Errorf("sections[%d] has no rows", i)
+		}
+		for j := range section.Rows {
+			row := &section.Rows[j]
+			rowCount++
+			if row.ID == "" {
+				row.ID = fmt.Sprintf("id%d", rowCount)
+			}
+			name := fmt.Sprintf("sections[%d].rows[%d]", i, j)
+			checks := []error{
+				checkLength(name+".id", row.ID, listMaxRowIDLength, true),
+				checkLength(name+".title", row.Title, listMaxRowTitleLength, true),
+				checkLength(name+".description", row.Description, listMaxRowDescriptionLength, false),
+			}
+			for _, err := range checks {
+				if err != nil {
+					return err
+				}
+			}
+			if rowIDs[row.ID] {
+				return fmt.Errorf("duplicate row ID %q", row.ID)
+			}
+			rowIDs[row.ID] = true
+		}
+	}
+	if rowCount > listMaxRows {
+		return fmt.Errorf("%d rows, the limit is %d", rowCount, listMaxRows)
+	}
+	return nil
+}
+
+// Message builds the list message.
+func (spec *ListSpec) Message() *waProto.Message {
+	sections := make([]*waProto.ListMessage_Section, 0, len(spec.Sections))
+	for _, section := range spec.Sections {
+		rows := make([]*waProto.ListMessage_Row, 0, len(section.Rows))
+		for _, row := range section.Rows {
+			rows = append(rows, &waProto.ListMessage_Row{
+				RowId:       proto.String(row.ID),
+				Title:       proto.String(row.Title),
+				Description: proto.String(row.Description),
+			})
+		}
+		sections = append(sections, &waProto.ListMessage_Section{
+			Title: proto.String(section.Title),
+			Rows:  rows,
+		})
+	}
+	return &waProto.Message{
+		ListMessage: &waProto.ListMessage{
+			Title:       proto.String(spec.Title),
+			Description: proto.String(spec.Text),
+			FooterText:  proto.String(spec.Footer),
+			ButtonText:  proto.String(spec.ButtonText),
+			ListType:    waProto.ListMessage_SINGLE_SELECT.Enum(),
+			Sections:    sections,
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		source string
+		ok     bool
+	}{
+		{"file", []string{"123@s.whatsapp.net", "@list.json"}, "@list.json", true},
+		{"compact json", []string{"123@s.whatsapp.net", `{"text":"hi"}`}, `{"text":"hi"}`, true},
+		{"json with spaces", []string{"123@s.whatsapp.net", `{"text":`, `"pick`, `one",`, `"button_text":"Go"}`}, `{"text": "pick one", "button_text":"Go"}`, true},
+		{"positional", []string{"123@s.whatsapp.net", "Title", "Text", "Footer", "Button", "Section", "--", "Row", "Desc", "/"}, "", false},
+		{"file with extra args", []string{"123@s.whatsapp.net", "@list.json", "extra"}, "", false},
+		{"jid only", []string{"123@s.whatsapp.net"}, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, ok := listSource(test.args)
+			if source != test.source || ok != test.ok {
+				t.Errorf("listSource() = %q, %v, want %q, %v", source, ok, test.source, test.ok)
+			}
+		})
+	}
+}
+
+func TestLoadListSpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.json")
+	err := os.WriteFile(path, []byte(`{"text":"From a file","button_text":"Open","sections":[{"rows":[{"title":"One"}]}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		text    string
+		wantErr string
+	}{
+		{"inline", `{"text": "pick one", "button_text": "Go", "sections": [{"rows": [{"title": "A"}]}]}`, "pick one", ""},
+		{"file", "@" + path, "From a file", ""},
+		{"missing file", "@" + path + ".missing", "", "no such file"},
+		{"unknown field", `{"text": "hi", "buttons": []}`, "", `unknown field "buttons"`},
+		{"invalid json", `{"text": `, "", "invalid list JSON"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := loadListSpec(test.source)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("loadListSpec() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("loadListSpec() error = %v", err)
+			}
+			if spec.Text != test.text {
+				t.Errorf("Text = %q, want %q", spec.Text, test.text)
+			}
+		})
+	}
+}
+
+func TestListSpecValidate(t *testing.T) {
+	row := func(id, title string) ListRowSpec {
+		return ListRowSpec{ID: id, Title: title}
+	}
+	valid := func() *ListSpec {
+		return &ListSpec{
+			Text:       "Pick one",
+			ButtonText: "Options",
+			Sections:   []ListSectionSpec{{Rows: []ListRowSpec{row("", "First"), row("custom", "Second")}}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(spec *ListSpec)
+		wantErr string
+	}{
+		{"valid", func(spec *ListSpec) {}, ""},
+		{"missing text", func(spec *ListSpec) { spec.Text = " " }, "text is required"},
+		{"missing button text", func(spec *ListSpec) { spec.ButtonText = "" }, "button_text is required"},
+		{"long button text", func(spec *ListSpec) { spec.ButtonText = strings.Repeat("é", listMaxButtonTextLength+1) }, "button_text is 21 characters long"},
+		{"button text at limit", func(spec *ListSpec) { spec.ButtonText = strings.Repeat("é", listMaxButtonTextLength) }, ""},
+		{"no sections", func(spec *ListSpec) { spec.Sections = nil }, "at least one section"},
+		{"empty section", func(spec *ListSpec) { spec.Sections[0].Rows = nil }, "sections[0] has no rows"},
+		{"untitled second section", func(spec *ListSpec) {
+			spec.Sections = append(spec.Sections, ListSectionSpec{Rows: []ListRowSpec{row("", "Third")}})
+		}, "sections[0].title is required"},
+		{"titled sections", func(spec *ListSpec) {
+			spec.Sections[0].Title = "A"
+			spec.Sections = append(spec.Sections, ListSectionSpec{Title: "B", Rows: []ListRowSpec{row("", "Third")}})
+		}, ""},
+		{"missing row title", func(spec *ListSpec) { spec.Sections[0].Rows[1].Title = "" }, "sections[0].rows[1].title is required"},
+		{"duplicate row ID", func(spec *ListSpec) { spec.Sections[0].Rows[1].ID = "id1" }, `duplicate row ID "id1"`},
+		{"too many rows", func(spec *ListSpec) {
+			for i := 0; i < listMaxRows; i++ {
+				spec.Sections[0].Rows = append(spec.Sections[0].Rows, row("", "More"))
+			}
+		}, "12 rows, the limit is 10"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := valid()
+			test.modify(spec)
+			err := spec.Validate()
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("Validate() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+
+	t.Run("fills in row IDs", func(t *testing.T) {
+		spec := valid()
+		if err := spec.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if id := spec.Sections[0].Rows[0].ID; id != "id1" {
+			t.Errorf("first row ID = %q, want id1", id)
+		}
+		if id := spec.Sections[0].Rows[1].ID; id != "custom" {
+			t.Errorf("second row ID = %q, want custom", id)
+		}
+	})
+}
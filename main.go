@@ -14,6 +14,13 @@ import (
 	"github.com/jessevdk/go-flags"
 )
 
+const notLoggedInMessage = "Not logged in. Please pair your device using:\n\n./wahelper pair-phone <number>\n\n<number> is \"Country Code\" + \"Phone Number\"\n(e.g., if Country Code = 91, then use 919876543210)\n\nor scan a QR code using:\n\n./wahelper pair-qr [file.png]"
+
+// isPairCommand reports whether cmd logs the device in and may therefore run before pairing.
+func isPairCommand(cmd string) bool {
+	return cmd == "pair-phone" || cmd == "pair-qr"
+}
+
 func main() {
 	// Parse command-line flags into the Config struct
 	var config whatsapp.Config
@@ -42,6 +49,19 @@ func main() {
 		go client.StartServer()
 	}
 
+	// Reload auto-reply rules when the rules file changes
+	if client.Rules != nil {
+		go client.Rules.Watch()
+	}
+
+	// Redeliver webhook events queued while the receiver was down
+	if config.Mode == "both" {
+		if len(config.WebhookURLs) == 0 {
+			client.Logger.Warnf("No --webhook-url set, received events won't be forwarded")
+		}
+		go client.RunWebhookQueue()
+	}
+
 	// Handle OS signals for graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -65,21 +85,29 @@ func main() {
 			time.Sleep(1 * time.Second)
 		}
 
-		// If not logged in, prompt to pair (unless the command is "pair-phone")
-		if !client.WAClient.IsLoggedIn() && cmd != "pair-phone" {
-			fmt.Fprintln(os.Stderr, "Not logged in. Please pair your device using:\n\n./wahelper pair-phone <number>\n\n<number> is \"Country Code\" + \"Phone Number\"\n(e.g., if Country Code = 91, then use 919876543210)")
+		// If not logged in, prompt to pair (unless the command is a pairing command)
+		if !client.WAClient.IsLoggedIn() && !isPairCommand(cmd) {
+			fmt.Fprintln(os.Stderr, notLoggedInMessage)
 			os.Exit(1)
 		}
 
-		// Handle the immediate command
+		// Handle the immediate command, which may read its media from stdin
+		client.StdinMedia.Store(true)
 		client.HandleCommand(cmd, args[1:])
+		client.StdinMedia.Store(false)
 
-		// Exit after handling the immediate command (unless it's "pair-phone")
-		if cmd != "pair-phone" {
+		// Bulk jobs and live locations run in the background, let them finish before exiting
+		client.BackgroundJobs.Wait()
+
+		// Exit after handling the immediate command (unless it's a pairing command)
+		if !isPairCommand(cmd) {
 			return
 		}
 	}
 
+	// Run scheduled commands while the process is up, but not for one-shot commands
+	go client.RunScheduler()
+
 	// Read commands from stdin for interactive mode
 	input := make(chan string)
 	go func() {
@@ -114,9 +142,9 @@ func main() {
 				time.Sleep(1 * time.Second)
 			}
 
-			// If not logged in, prompt to pair (unless the command is "pair-phone")
-			if !client.WAClient.IsLoggedIn() && cmdName != "pair-phone" {
-				fmt.Fprintln(os.Stderr, "Not logged in. Please pair your device using:\n\n./wahelper pair-phone <number>\n\n<number> is \"Country Code\" + \"Phone Number\"\n(e.g., if Country Code = 91, then use 919876543210)")
+			// If not logged in, prompt to pair (unless the command is a pairing command)
+			if !client.WAClient.IsLoggedIn() && !isPairCommand(cmdName) {
+				fmt.Fprintln(os.Stderr, notLoggedInMessage)
 				continue
 			}
 
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+	"wahelper/utils"
+)
+
+// MediaSource is media to send, loaded from a local path, an http(s) URL, a data: URI or stdin.
+type MediaSource struct {
+	// Data is the media, or nil if it's only on disk at Path
+	Data     []byte
+	FileName string
+	MimeType string
+	// Path is the local file the media was read from, empty if it didn't come from disk
+	Path string
+}
+
+// sendMediaFields are the form fields of POST /send/media besides the file.
+var sendMediaFields = map[string]bool{
+	"jid": true, "kind": true, "caption": true, "filename": true, "mimetype": true,
+	"reply_to": true, "reply_sender": true, "reply_text": true, "no_mentions": true,
+}
+
+const (
+	// maxSendMediaField is the maximum size of a POST /send/media form field.
+	maxSendMediaField = 64 * 1024
+	// sendMediaOverhead is how much larger than --media-max-size a POST /send/media body
+	// may be, for the form fields and the multipart headers.
+	sendMediaOverhead = 1024 * 1024
+)
+
+var errMediaTooLarge = errors.New("media is larger than --media-max-size")
+
+// detectMimeType detects the mimetype of data from its content.
+func detectMimeType(data []byte) string {
+	if match := utils.MatchMimeType(data); match != nil && match.MediaType() != "" {
+		return match.MediaType()
+	}
+	return http.DetectContentType(data)
+}
+
+// readLimited reads r, failing if it's larger than limit bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) > limit {
+		return nil, fmt.Errorf("media is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// loadMedia reads media from a local path, an http(s) URL, a data: URI or "-" for
+// stdin. Stdin can only be read once, by the single command given on the command
+// line (see Client.StdinMedia), since interactive mode reads its commands from there.
+func (c *Client) loadMedia(source string) (*MediaSource, error) {
+	media := &MediaSource{}
+	var err error
+	switch {
+	case source == "-":
+		if !c.StdinMedia.CompareAndSwap(true, false) {
+			return nil, fmt.Errorf("media can only be read from stdin by a command given on the command line")
+		}
+		media.Data, err = readLimited(os.Stdin, c.Config.MediaMaxSize)
+	case strings.HasPrefix(source, "data:"):
+		err = c.loadDataURI(media, source)
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		err = c.downloadMedia(media, source)
+	default:
+		media.Path = source
+		media.FileName = filepath.Base(source)
+		media.Data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	} else if len(media.Data) == 0 {
+		return nil, fmt.Errorf("media is empty")
+	}
+	if media.MimeType == "" || media.MimeType == "application/octet-stream" {
+		media.MimeType = detectMimeType(media.Data)
+	}
+	if media.FileName == "" {
+		media.FileName = "file"
+		if extensions, _ := mime.ExtensionsByType(media.MimeType); len(extensions) > 0 {
+			media.FileName += extensions[0]
+		}
+	}
+	return media, nil
+}
+
+// loadDataURI decodes a data:[<mediatype>][;base64],<data> URI.
+func (c *Client) loadDataURI(media *MediaSource, uri string) error {
+	meta, payload, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !found {
+		return fmt.Errorf("invalid data URI: missing ','")
+	}
+	isBase64 := strings.HasSuffix(meta, ";base64")
+	media.MimeType = strings.TrimSuffix(meta, ";base64")
+	if mimeType, _, err := mime.ParseMediaType(media.MimeType); err == nil {
+		media.MimeType = mimeType
+	}
+	var err error
+	if isBase64 {
+		media.Data, err = base64.StdEncoding.DecodeString(payload)
+	} else {
+		var unescaped string
+		unescaped, err = url.PathUnescape(payload)
+		media.Data = []byte(unescaped)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid data URI: %w", err)
+	} else if int64(len(media.Data)) > c.Config.MediaMaxSize {
+		return fmt.Errorf("media is larger than %d bytes", c.Config.MediaMaxSize)
+	}
+	return nil
+}
+
+// downloadMedia downloads media from a URL, taking the file name from the
+// Content-Disposition header or the last part of the URL path.
+func (c *Client) downloadMedia(media *MediaSource, rawURL string) error {
+	httpClient := &http.Client{Timeout: c.Config.MediaTimeout}
+	resp, err := httpClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("download failed with status %s", resp.Status)
+	} else if resp.ContentLength > c.Config.MediaMaxSize {
+		return fmt.Errorf("media is larger than %d bytes", c.Config.MediaMaxSize)
+	}
+	media.Data, err = readLimited(resp.Body, c.Config.MediaMaxSize)
+	if err != nil {
+		return err
+	}
+
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		media.FileName = filepath.Base(params["filename"])
+	} else if parsed, err := url.Parse(rawURL); err == nil {
+		if name := path.Base(parsed.Path); name != "" && name != "." && name != "/" {
+			media.FileName = name
+		}
+	}
+	return nil
+}
+
+// spoolMedia copies r to a temporary file, so that large uploads aren't held in memory.
+// The caller must remove the file at the returned media's Path.
+func spoolMedia(r io.Reader, fileName string, limit int64) (*MediaSource, error) {
+	file, err := os.CreateTemp("", "wahelper-*"+filepath.Ext(fileName))
+	if err != nil {
+		return nil, err
+	}
+	media := &MediaSource{Path: file.Name(), FileName: filepath.Base(fileName)}
+	n, err := io.Copy(file, io.LimitReader(r, limit+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > limit {
+		err = errMediaTooLarge
+	} else if err == nil && n == 0 {
+		err = fmt.Errorf("media is empty")
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return media, nil
+}
+
+// open returns a reader of the media.
+func (m *MediaSource) open() (io.ReadCloser, error) {
+	if m.Data != nil {
+		return io.NopCloser(bytes.NewReader(m.Data)), nil
+	}
+	return os.Open(m.Path)
+}
+
+// head returns the start of the media, which is enough to detect its mimetype.
+func (m *MediaSource) head() ([]byte, error) {
+	if m.Data != nil {
+		return m.Data, nil
+	}
+	file, err := os.Open(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(file, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// localPath returns a local file with the media for tools like ffmpeg, writing it to
+// a temporary file if it didn't come from disk. cleanup removes that file.
+func (m *MediaSource) localPath() (string, func(), error) {
+	if m.Path != "" {
+		return m.Path, func() {}, nil
+	}
+	file, err := os.CreateTemp("", "wahelper-*"+filepath.Ext(m.FileName))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+	_, err = file.Write(m.Data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+// mediaKind guesses how media should be sent from its mimetype.
+func mediaKind(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	}
+	return "document"
+}
+
+// UploadedMedia is media that was converted and uploaded once and can be sent in any
+// number of messages. Bulk jobs keep it so that the media is uploaded once per job.
+type UploadedMedia struct {
+	// Kind is image, video, audio, voice, document or sticker
+	Kind          string `json:"kind"`
+	URL           string `json:"url"`
+	DirectPath    string `json:"direct_path"`
+	MediaKey      []byte `json:"media_key"`
+	FileEncSHA256 []byte `json:"file_enc_sha256"`
+	FileSHA256    []byte `json:"file_sha256"`
+	FileLength    uint64 `json:"file_length"`
+	MimeType      string `json:"mimetype"`
+	FileName      string `json:"file_name,omitempty"`
+	Thumbnail     []byte `json:"thumbnail,omitempty"`
+	// Seconds and Waveform are only set for voice notes, IsAnimated for stickers
+	Seconds    uint32 `json:"seconds,omitempty"`
+	Waveform   []byte `json:"waveform,omitempty"`
+	IsAnimated bool   `json:"is_animated,omitempty"`
+}
+
+// uploadMedia converts media as needed for the given kind and uploads it.
+func (c *Client) uploadMedia(kind string, media *MediaSource) (*UploadedMedia, error) {
+	uploaded := &UploadedMedia{Kind: kind, MimeType: media.MimeType, FileName: media.FileName}
+	data := media.Data
+	var mediaType whatsmeow.MediaType
+	var err error
+	switch kind {
+	case "image", "video":
+		mediaType = whatsmeow.MediaImage
+		if kind == "video" {
+			mediaType = whatsmeow.MediaVideo
+		}
+		uploaded.Thumbnail, err = createMediaThumbnail(media)
+		if err != nil {
+			c.Logger.Errorf("Error creating thumbnail: %v", err)
+		}
+	case "audio":
+		mediaType = whatsmeow.MediaAudio
+	case "voice":
+		mediaType = whatsmeow.MediaAudio
+		audioPath, cleanup, err := media.localPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare %s for conversion: %w", media.FileName, err)
+		}
+		defer cleanup()
+		data, err = convertToOpus(audioPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s to Opus: %w", media.FileName, err)
+		}
+		uploaded.MimeType = "audio/ogg; codecs=opus"
+		uploaded.Seconds, uploaded.Waveform, err = audioWaveform(audioPath)
+		if err != nil {
+			c.Logger.Errorf("Error creating waveform: %v", err)
+		}
+	case "document":
+		mediaType = whatsmeow.MediaDocument
+	case "sticker":
+		mediaType = whatsmeow.MediaImage
+		uploaded.IsAnimated, err = checkStickerSource(media)
+		if err != nil {
+			return nil, err
+		}
+		sourcePath, cleanup, err := media.localPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare %s for conversion: %w", media.FileName, err)
+		}
+		defer cleanup()
+		data, err = convertToSticker(sourcePath, uploaded.IsAnimated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s to a sticker: %w", media.FileName, err)
+		}
+		uploaded.MimeType = "image/webp"
+	default:
+		return nil, fmt.Errorf("invalid media kind: %s. Valid kinds are image, video, audio, voice, document, sticker", kind)
+	}
+
+	var resp whatsmeow.UploadResponse
+	if data != nil {
+		resp, err = c.WAClient.Upload(context.Background(), data, mediaType)
+	} else {
+		// Media that is only on disk is streamed instead of being read into memory
+		var file *os.File
+		if file, err = os.Open(media.Path); err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		resp, err = c.WAClient.UploadReader(context.Background(), file, nil, mediaType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", kind, err)
+	}
+	uploaded.URL = resp.URL
+	uploaded.DirectPath = resp.DirectPath
+	uploaded.MediaKey = resp.MediaKey
+	uploaded.FileEncSHA256 = resp.FileEncSHA256
+	uploaded.FileSHA256 = resp.FileSHA256
+	uploaded.FileLength = resp.FileLength
+	return uploaded, nil
+}
+
+// Message builds a message with the uploaded media. The caption is ignored for audio,
+// voice notes and stickers, which can't have one.
+func (u *UploadedMedia) Message(caption string) *waProto.Message {
+	switch u.Kind {
+	case "image":
+		return &waProto.Message{ImageMessage: &waProto.ImageMessage{
+			Caption:       proto.String(caption),
+			Url:           proto.String(u.URL),
+			DirectPath:    proto.String(u.DirectPath),
+			MediaKey:      u.MediaKey,
+			Mimetype:      proto.String(u.MimeType),
+			FileEncSha256: u.FileEncSHA256,
+			FileSha256:    u.FileSHA256,
+			FileLength:    proto.Uint64(u.FileLength),
+			JpegThumbnail: u.Thumbnail,
+		}}
+	case "video":
+		return &waProto.Message{VideoMessage: &waProto.VideoMessage{
+			Caption:       proto.String(caption),
+			Url:           proto.String(u.URL),
+			DirectPath:    proto.String(u.DirectPath),
+			MediaKey:      u.MediaKey,
+			Mimetype:      proto.String(u.MimeType),
+			FileEncSha256: u.FileEncSHA256,
+			FileSha256:    u.FileSHA256,
+			FileLength:    proto.Uint64(u.FileLength),
+			JpegThumbnail: u.Thumbnail,
+		}}
+	case "audio", "voice":
+		audio := &waProto.AudioMessage{
+			Url:           proto.String(u.URL),
+			DirectPath:    proto.String(u.DirectPath),
+			MediaKey:      u.MediaKey,
+			Mimetype:      proto.String(u.MimeType),
+			FileEncSha256: u.FileEncSHA256,
+			FileSha256:    u.FileSHA256,
+			FileLength:    proto.Uint64(u.FileLength),
+		}
+		if u.Kind == "voice" {
+			audio.Seconds = proto.Uint32(u.Seconds)
+			audio.Ptt = proto.Bool(true)
+			audio.Waveform = u.Waveform
+		}
+		return &waProto.Message{AudioMessage: audio}
+	case "document":
+		return &waProto.Message{DocumentMessage: &waProto.DocumentMessage{
+			Title:         proto.String(u.FileName),
+			FileName:      proto.String(u.FileName),
+			Caption:       proto.String(caption),
+			Url:           proto.String(u.URL),
+			DirectPath:    proto.String(u.DirectPath),
+			MediaKey:      u.MediaKey,
+			Mimetype:      proto.String(u.MimeType),
+			FileEncSha256: u.FileEncSHA256,
+			FileSha256:    u.FileSHA256,
+			FileLength:    proto.Uint64(u.FileLength),
+		}}
+	case "sticker":
+		return &waProto.Message{StickerMessage: &waProto.StickerMessage{
+			Url:           proto.String(u.URL),
+			DirectPath:    proto.String(u.DirectPath),
+			MediaKey:      u.MediaKey,
+			Mimetype:      proto.String(u.MimeType),
+			FileEncSha256: u.FileEncSHA256,
+			FileSha256:    u.FileSHA256,
+			FileLength:    proto.Uint64(u.FileLength),
+			Width:         proto.Uint32(stickerSize),
+			Height:        proto.Uint32(stickerSize),
+			IsAnimated:    proto.Bool(u.IsAnimated),
+		}}
+	}
+	return nil
+}
+
+// sendUploadedMedia sends already uploaded media to recipient.
+func (c *Client) sendUploadedMedia(recipient types.JID, uploaded *UploadedMedia, caption string, opts *SendOptions) (*CommandResult, error) {
+	msg := uploaded.Message(caption)
+	if msg == nil {
+		return nil, c.failf("Invalid media kind: %s", uploaded.Kind)
+	}
+	if err := c.applySendOptions(recipient, msg, opts); err != nil {
+		return nil, c.failf("Failed to prepare message: %v", err)
+	}
+	resp, err := c.sendMessage(recipient, msg)
+	if err != nil {
+		return nil, c.failf("Error sending %s message: %v", uploaded.Kind, err)
+	}
+	c.Logger.Infof("Sent %s message %s (server timestamp: %s)", uploaded.Kind, resp.ID, resp.Timestamp)
+	return sendResult(resp), nil
+}
+
+// sendMedia sends media as the given kind: image, video, audio, voice, document or sticker.
+func (c *Client) sendMedia(recipient types.JID, kind string, media *MediaSource, caption string, opts *SendOptions) (*CommandResult, error) {
+	uploaded, err := c.uploadMedia(kind, media)
+	if err != nil {
+		return nil, c.failf("Failed to send %s: %v", media.FileName, err)
+	}
+	return c.sendUploadedMedia(recipient, uploaded, caption, opts)
+}
+
+// HandleSendMediaRequest serves POST /send/media. The multipart form has the media in
+// the "file" part and the fields jid, kind (default: guessed from the mimetype),
+// caption, filename, mimetype, reply_to, reply_sender, reply_text and no_mentions.
+func (c *Client) HandleSendMediaRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	} else if !c.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, c.Config.MediaMaxSize+sendMediaOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	fields := make(map[string]string)
+	var media *MediaSource
+	defer func() {
+		if media != nil {
+			os.Remove(media.Path)
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read form: %v", err), http.StatusBadRequest)
+			return
+		}
+		name := part.FormName()
+		if name == "file" {
+			if media != nil {
+				http.Error(w, "Duplicate file", http.StatusBadRequest)
+				return
+			}
+			media, err = spoolMedia(part, part.FileName(), c.Config.MediaMaxSize)
+			if errors.Is(err, errMediaTooLarge) {
+				http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusRequestEntityTooLarge)
+				return
+			} else if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusBadRequest)
+				return
+			}
+			media.MimeType = part.Header.Get("Content-Type")
+		} else {
+			if !sendMediaFields[name] {
+				http.Error(w, fmt.Sprintf("Unknown field %s", name), http.StatusBadRequest)
+				return
+			} else if _, ok := fields[name]; ok {
+				http.Error(w, fmt.Sprintf("Duplicate field %s", name), http.StatusBadRequest)
+				return
+			}
+			value, err := readLimited(part, maxSendMediaField)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to read field %s: %v", name, err), http.StatusBadRequest)
+				return
+			}
+			fields[name] = string(value)
+		}
+		part.Close()
+	}
+	if media == nil {
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+	recipient, ok := utils.ParseJID(fields["jid"])
+	if !ok {
+		http.Error(w, "Missing or invalid jid", http.StatusBadRequest)
+		return
+	}
+
+	if fields["mimetype"] != "" {
+		media.MimeType = fields["mimetype"]
+	} else if media.MimeType == "" || media.MimeType == "application/octet-stream" {
+		head, err := media.head()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusInternalServerError)
+			return
+		}
+		media.MimeType = detectMimeType(head)
+	}
+	if fields["filename"] != "" {
+		media.FileName = fields["filename"]
+	} else if media.FileName == "" || media.FileName == "." {
+		media.FileName = "file"
+	}
+	kind := fields["kind"]
+	if kind == "" {
+		kind = mediaKind(media.MimeType)
+	}
+	opts := &SendOptions{
+		ReplyTo:     fields["reply_to"],
+		ReplySender: fields["reply_sender"],
+		ReplyText:   fields["reply_text"],
+		NoMentions:  fields["no_mentions"] == "true" || fields["no_mentions"] == "1",
+	}
+	writeJSON(w, newCommandResponse(c.sendMedia(recipient, kind, media, fields["caption"], opts)))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	phoneMentionRegex = regexp.MustCompile(`@\+?(\d{6,15})\b`)
+	nameMentionRegex  = regexp.MustCompile(`@\pL`)
+)
+
+// contactNames returns the JIDs of all contacts by their known names in lowercase, and
+// the length in runes of the longest name.
+func (c *Client) contactNames() (map[string]types.JID, int) {
+	contacts, err := c.WAClient.Store.Contacts.GetAllContacts()
+	if err != nil {
+		c.Logger.Warnf("Failed to get contacts for mentions: %v", err)
+		return nil, 0
+	}
+	names := make(map[string]types.JID)
+	longest := 0
+	for jid, contact := range contacts {
+		for _, name := range []string{contact.FullName, contact.FirstName, contact.PushName, contact.BusinessName} {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				names[name] = jid
+				longest = max(longest, utf8.RuneCountInString(name))
+			}
+		}
+	}
+	return names, longest
+}
+
+// replaceNameMentions rewrites @<name> mentions of the given names to @<phone number>,
+// which is how WhatsApp renders them. At every @ the longest matching name wins, so
+// "@John Smith" is preferred over "@John". A name must end at a non-alphanumeric rune.
+func replaceNameMentions(text string, names map[string]types.JID, longest int) (string, []types.JID) {
+	var out strings.Builder
+	var mentioned []types.JID
+	last := 0
+	for _, loc := range nameMentionRegex.FindAllStringIndex(text, -1) {
+		if loc[0] < last {
+			continue
+		}
+		// Collect where a name after the @ could end, up to the length of the longest name
+		start := loc[0] + 1
+		var ends []int
+		length := 0
+		for i, r := range text[start:] {
+			if length > longest {
+				break
+			} else if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+				ends = append(ends, start+i)
+			}
+			length++
+		}
+		if length <= longest {
+			ends = append(ends, len(text))
+		}
+		for i := len(ends) - 1; i >= 0; i-- {
+			jid, ok := names[strings.ToLower(text[start:ends[i]])]
+			if !ok {
+				continue
+			}
+			out.WriteString(text[last:loc[0]])
+			out.WriteString("@" + jid.User)
+			last = ends[i]
+			mentioned = append(mentioned, jid)
+			break
+		}
+	}
+	out.WriteString(text[last:])
+	return out.String(), mentioned
+}
+
+// resolveMentions finds @<phone number> and @<contact name> mentions in text. Name
+// mentions are rewritten to @<phone number>, which is how WhatsApp renders them.
+func (c *Client) resolveMentions(text string) (string, []string) {
+	var mentioned []string
+	seen := make(map[string]bool)
+	mention := func(jid types.JID) {
+		if !seen[jid.String()] {
+			seen[jid.String()] = true
+			mentioned = append(mentioned, jid.String())
+		}
+	}
+
+	// Contacts are only loaded when the text may mention someone by name
+	if nameMentionRegex.MatchString(text) {
+		names, longest := c.contactNames()
+		var jids []types.JID
+		text, jids = replaceNameMentions(text, names, longest)
+		for _, jid := range jids {
+			mention(jid)
+		}
+	}
+
+	text = phoneMentionRegex.ReplaceAllStringFunc(text, func(match string) string {
+		phone := phoneMentionRegex.FindStringSubmatch(match)[1]
+		mention(types.NewJID(phone, types.DefaultUserServer))
+		return "@" + phone
+	})
+	return text, mentioned
+}
+
+// textField returns the text or caption of msg, if it has one.
+func textField(msg *waProto.Message) **string {
+	switch {
+	case msg.Conversation != nil:
+		return &msg.Conversation
+	case msg.ExtendedTextMessage != nil:
+		return &msg.ExtendedTextMessage.Text
+	case msg.ImageMessage != nil:
+		return &msg.ImageMessage.Caption
+	case msg.VideoMessage != nil:
+		return &msg.VideoMessage.Caption
+	case msg.DocumentMessage != nil:
+		return &msg.DocumentMessage.Caption
+	}
+	return nil
+}
+
+// addMentions adds jids to the mentions of msg, skipping ones that are already there.
+func addMentions(msg *waProto.Message, jids []string) {
+	if len(jids) == 0 {
+		return
+	}
+	ctxInfo := ensureContextInfo(msg)
+	if ctxInfo == nil {
+		return
+	}
+	for _, jid := range jids {
+		found := false
+		for _, existing := range ctxInfo.MentionedJid {
+			if existing == jid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ctxInfo.MentionedJid = append(ctxInfo.MentionedJid, jid)
+		}
+	}
+}
+
+// applyMentions turns the mentions in the text or caption of msg into real mentions.
+func (c *Client) applyMentions(msg *waProto.Message) {
+	field := textField(msg)
+	if field == nil || *field == nil || !strings.Contains(**field, "@") {
+		return
+	}
+	text, mentioned := c.resolveMentions(**field)
+	if len(mentioned) == 0 {
+		return
+	}
+	*field = proto.String(text)
+	addMentions(msg, mentioned)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestReplaceNameMentions(t *testing.T) {
+	john := types.NewJID("111", types.DefaultUserServer)
+	johnSmith := types.NewJID("222", types.DefaultUserServer)
+	zoe := types.NewJID("333", types.HiddenUserServer)
+	names := map[string]types.JID{
+		"john":       john,
+		"john smith": johnSmith,
+		"zoë":        zoe,
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		mentioned []types.JID
+	}{
+		{"single", "hi @John!", "hi @111!", []types.JID{john}},
+		{"longest name wins", "hi @John Smith, welcome", "hi @222, welcome", []types.JID{johnSmith}},
+		{"shorter name before other words", "@john said hi", "@111 said hi", []types.JID{john}},
+		{"name at end", "thanks @JOHN", "thanks @111", []types.JID{john}},
+		{"non-ascii and lid", "@Zoë and @john", "@333 and @111", []types.JID{zoe, john}},
+		{"name must end at a word boundary", "hi @johnny", "hi @johnny", nil},
+		{"unknown name", "hi @alice", "hi @alice", nil},
+		{"email address", "mail john@example.com", "mail john@example.com", nil},
+		{"repeated", "@john @john", "@111 @111", []types.JID{john, john}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, mentioned := replaceNameMentions(test.text, names, len("john smith"))
+			if text != test.want || !reflect.DeepEqual(mentioned, test.mentioned) {
+				t.Errorf("replaceNameMentions() = %q, %v, want %q, %v", text, mentioned, test.want, test.mentioned)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// PollStore keeps the polls we send, their option hashes and the current votes in
+// the same database as the whatsmeow sqlstore container.
+type PollStore struct {
+	db *sql.DB
+}
+
+// PollOptionResult is the number of votes for a single poll option.
+type PollOptionResult struct {
+	Option string   `json:"option"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters"`
+}
+
+// PollResults is the aggregated tally of a poll.
+type PollResults struct {
+	MessageID string             `json:"message_id"`
+	Chat      string             `json:"chat"`
+	Question  string             `json:"question"`
+	Options   []PollOptionResult `json:"options"`
+}
+
+func NewPollStore(db *sql.DB) *PollStore {
+	return &PollStore{db: db}
+}
+
+func (s *PollStore) Upgrade() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS wahelper_polls (
+			message_id TEXT PRIMARY KEY,
+			chat_jid   TEXT NOT NULL,
+			question   TEXT NOT NULL,
+			created_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS wahelper_poll_options (
+			message_id  TEXT NOT NULL REFERENCES wahelper_polls(message_id) ON DELETE CASCADE,
+			option_hash TEXT NOT NULL,
+			option_name TEXT NOT NULL,
+			position    INTEGER NOT NULL,
+			PRIMARY KEY (message_id, option_hash)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wahelper_poll_votes (
+			message_id  TEXT NOT NULL REFERENCES wahelper_polls(message_id) ON DELETE CASCADE,
+			voter_jid   TEXT NOT NULL,
+			option_hash TEXT NOT NULL,
+			voted_at    BIGINT NOT NULL,
+			PRIMARY KEY (message_id, voter_jid, option_hash)
+		)`,
+	}
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create poll tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// pollOptionHash is the hash WhatsApp uses to refer to a poll option in votes.
+func pollOptionHash(option string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(option)))
+}
+
+// SavePoll records a poll we sent so that incoming votes can be resolved.
+func (s *PollStore) SavePoll(messageID types.MessageID, chat types.JID, question string, options []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO wahelper_polls (message_id, chat_jid, question, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id) DO UPDATE SET chat_jid=excluded.chat_jid, question=excluded.question`,
+		messageID, chat.String(), question, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save poll: %w", err)
+	}
+	for i, option := range options {
+		_, err = tx.Exec(`INSERT INTO wahelper_poll_options (message_id, option_hash, option_name, position) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (message_id, option_hash) DO UPDATE SET option_name=excluded.option_name, position=excluded.position`,
+			messageID, pollOptionHash(option), option, i)
+		if err != nil {
+			return fmt.Errorf("failed to save poll option: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetPoll returns the question of a poll and its options keyed by option hash.
+// The returned question is empty if the poll is unknown.
+func (s *PollStore) GetPoll(messageID types.MessageID) (string, map[string]string, error) {
+	var question string
+	err := s.db.QueryRow(`SELECT question FROM wahelper_polls WHERE message_id=$1`, messageID).Scan(&question)
+	if err == sql.ErrNoRows {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	rows, err := s.db.Query(`SELECT option_hash, option_name FROM wahelper_poll_options WHERE message_id=$1`, messageID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	options := make(map[string]string)
+	for rows.Next() {
+		var hash, name string
+		if err = rows.Scan(&hash, &name); err != nil {
+			return "", nil, err
+		}
+		options[hash] = name
+	}
+	return question, options, rows.Err()
+}
+
+// SetVotes replaces the current selection of a voter, as every poll update carries
+// the complete set of options the voter has selected.
+func (s *PollStore) SetVotes(messageID types.MessageID, voter types.JID, selectedHashes []string, ts time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DELETE FROM wahelper_poll_votes WHERE message_id=$1 AND voter_jid=$2`, messageID, voter.ToNonAD().String())
+	if err != nil {
+		return fmt.Errorf("failed to clear previous votes: %w", err)
+	}
+	for _, hash := range selectedHashes {
+		_, err = tx.Exec(`INSERT INTO wahelper_poll_votes (message_id, voter_jid, option_hash, voted_at) VALUES ($1, $2, $3, $4)`,
+			messageID, voter.ToNonAD().String(), hash, ts.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to save vote: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetResults aggregates the current votes of a poll, or returns nil if the poll is unknown.
+func (s *PollStore) GetResults(messageID types.MessageID) (*PollResults, error) {
+	results := &PollResults{MessageID: messageID}
+	err := s.db.QueryRow(`SELECT chat_jid, question FROM wahelper_polls WHERE message_id=$1`, messageID).Scan(&results.Chat, &results.Question)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT o.option_name, v.voter_jid FROM wahelper_poll_options o
+		LEFT JOIN wahelper_poll_votes v ON v.message_id=o.message_id AND v.option_hash=o.option_hash
+		WHERE o.message_id=$1 ORDER BY o.position`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	index := make(map[string]int)
+	for rows.Next() {
+		var option string
+		var voter sql.NullString
+		if err = rows.Scan(&option, &voter); err != nil {
+			return nil, err
+		}
+		i, ok := index[option]
+		if !ok {
+			i = len(results.Options)
+			index[option] = i
+			results.Options = append(results.Options, PollOptionResult{Option: option, Voters: []string{}})
+		}
+		if voter.Valid {
+			results.Options[i].Votes++
+			results.Options[i].Voters = append(results.Options[i].Voters, voter.String)
+		}
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestPollStore(t *testing.T) {
+	store := NewPollStore(openTestDB(t))
+	if err := store.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	chat := types.NewJID("123", types.GroupServer)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewADJID("222", 0, 3)
+	options := []string{"Red", "Green", "Blue"}
+	if err := store.SavePoll("poll1", chat, "Favourite colour?", options); err != nil {
+		t.Fatal(err)
+	}
+
+	question, hashes, err := store.GetPoll("poll1")
+	if err != nil {
+		t.Fatal(err)
+	} else if question != "Favourite colour?" {
+		t.Errorf("GetPoll() question = %q", question)
+	}
+	for _, option := range options {
+		if hashes[pollOptionHash(option)] != option {
+			t.Errorf("GetPoll() has no hash for %q", option)
+		}
+	}
+
+	now := time.Now()
+	votes := []struct {
+		voter   types.JID
+		options []string
+	}{
+		{alice, []string{"Red", "Blue"}},
+		{bob, []string{"Red"}},
+		// Every update carries the complete selection, so this replaces alice's first vote
+		{alice, []string{"Green"}},
+	}
+	for _, vote := range votes {
+		selected := make([]string, len(vote.options))
+		for i, option := range vote.options {
+			selected[i] = pollOptionHash(option)
+		}
+		if err = store.SetVotes("poll1", vote.voter, selected, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := store.GetResults("poll1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PollResults{
+		MessageID: "poll1",
+		Chat:      chat.String(),
+		Question:  "Favourite colour?",
+		Options: []PollOptionResult{
+			{Option: "Red", Votes: 1, Voters: []string{"222@s.whatsapp.net"}},
+			{Option: "Green", Votes: 1, Voters: []string{"111@s.whatsapp.net"}},
+			{Option: "Blue", Votes: 0, Voters: []string{}},
+		},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("GetResults() = %+v, want %+v", results, want)
+	}
+
+	if results, err = store.GetResults("unknown"); err != nil || results != nil {
+		t.Errorf("GetResults() of unknown poll = %+v, %v, want nil", results, err)
+	}
+	if question, _, err = store.GetPoll("unknown"); err != nil || question != "" {
+		t.Errorf("GetPoll() of unknown poll = %q, %v, want empty", question, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ReceiptStore keeps the delivery, read and played receipts of the messages we send
+// in the same database as the whatsmeow sqlstore container.
+type ReceiptStore struct {
+	db *sql.DB
+}
+
+// RecipientStatus is how far a message got with a single recipient. Nil times
+// mean the corresponding receipt hasn't arrived.
+type RecipientStatus struct {
+	JID         string     `json:"jid"`
+	Status      string     `json:"status"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	PlayedAt    *time.Time `json:"played_at,omitempty"`
+}
+
+// receiptStatusRank orders receipt statuses from the least to the most progress.
+var receiptStatusRank = map[string]int{"sent": 0, "delivered": 1, "read": 2, "played": 3}
+
+func NewReceiptStore(db *sql.DB) *ReceiptStore {
+	return &ReceiptStore{db: db}
+}
+
+func (s *ReceiptStore) Upgrade() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS wahelper_receipts (
+			message_id    TEXT   NOT NULL,
+			chat_jid      TEXT   NOT NULL,
+			recipient_jid TEXT   NOT NULL,
+			status        TEXT   NOT NULL,
+			timestamp     BIGINT NOT NULL,
+			PRIMARY KEY (message_id, recipient_jid, status)
+		)`,
+	}
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create receipt tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// SaveReceipt records that the messages were delivered, read or played by recipient.
+// Only the first receipt of each status is kept.
+func (s *ReceiptStore) SaveReceipt(chat types.JID, messageIDs []types.MessageID, recipient types.JID, status string, ts time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, messageID := range messageIDs {
+		_, err = tx.Exec(`INSERT INTO wahelper_receipts (message_id, chat_jid, recipient_jid, status, timestamp) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (message_id, recipient_jid, status) DO NOTHING`,
+			messageID, chat.String(), recipient.ToNonAD().String(), status, ts.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to save receipt: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetReceipts returns the chat of a message and the status of every recipient that sent
+// a receipt for it. The chat is empty if no receipts are known.
+func (s *ReceiptStore) GetReceipts(messageID types.MessageID) (string, []RecipientStatus, error) {
+	rows, err := s.db.Query(`SELECT chat_jid, recipient_jid, status, timestamp FROM wahelper_receipts
+		WHERE message_id=$1 ORDER BY recipient_jid`, messageID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	chat := ""
+	recipients := []RecipientStatus{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var recipient, status string
+		var ts int64
+		if err = rows.Scan(&chat, &recipient, &status, &ts); err != nil {
+			return "", nil, err
+		}
+		i, ok := index[recipient]
+		if !ok {
+			i = len(recipients)
+			index[recipient] = i
+			recipients = append(recipients, RecipientStatus{JID: recipient, Status: "sent"})
+		}
+		at := time.Unix(ts, 0)
+		switch status {
+		case "delivered":
+			recipients[i].DeliveredAt = &at
+		case "read":
+			recipients[i].ReadAt = &at
+		case "played":
+			recipients[i].PlayedAt = &at
+		}
+		if receiptStatusRank[status] > receiptStatusRank[recipients[i].Status] {
+			recipients[i].Status = status
+		}
+	}
+	return chat, recipients, rows.Err()
+}
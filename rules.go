@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"gopkg.in/yaml.v3"
+	"wahelper/utils"
+)
+
+// rulesReloadInterval is how often the rules file is checked for changes.
+const rulesReloadInterval = 5 * time.Second
+
+// RulesFile is the YAML (or JSON) document loaded from --rules-file.
+type RulesFile struct {
+	Rules []*Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule runs its actions for every received message that matches all of its conditions.
+type Rule struct {
+	Name string `yaml:"name" json:"name"`
+	// Cooldown is the minimum time between two runs of the rule in the same chat
+	Cooldown time.Duration `yaml:"cooldown" json:"cooldown"`
+	// Stop prevents the rules after this one from running when it matched
+	Stop    bool         `yaml:"stop" json:"stop"`
+	Match   RuleMatch    `yaml:"match" json:"match"`
+	Actions []RuleAction `yaml:"actions" json:"actions"`
+
+	textRegex *regexp.Regexp
+}
+
+// RuleMatch lists the conditions of a rule. Empty conditions match everything.
+type RuleMatch struct {
+	Senders      []string    `yaml:"senders" json:"senders"`
+	Groups       []string    `yaml:"groups" json:"groups"`
+	ChatType     string      `yaml:"chat_type" json:"chat_type"`
+	MessageTypes []string    `yaml:"message_types" json:"message_types"`
+	Text         string      `yaml:"text" json:"text"`
+	TimeWindow   *TimeWindow `yaml:"time_window" json:"time_window"`
+}
+
+// TimeWindow limits a rule to certain (local) hours and weekdays. A window where
+// From is after To spans midnight.
+type TimeWindow struct {
+	Days []string `yaml:"days" json:"days"`
+	From string   `yaml:"from" json:"from"`
+	To   string   `yaml:"to" json:"to"`
+}
+
+// RuleAction is one of reply, react, forward, mark_read, label_chat or webhook.
+// Text fields may contain {{pushname}}, {{sender}}, {{chat}}, {{text}} and {{message_id}}.
+type RuleAction struct {
+	Type  string `yaml:"type" json:"type"`
+	Text  string `yaml:"text" json:"text"`
+	Emoji string `yaml:"emoji" json:"emoji"`
+	To    string `yaml:"to" json:"to"`
+	Label string `yaml:"label" json:"label"`
+	URL   string `yaml:"url" json:"url"`
+}
+
+// RuleEngine applies the rules of the rules file to received messages and reloads
+// the file when it changes.
+type RuleEngine struct {
+	client  *Client
+	path    string
+	lock    sync.Mutex
+	rules   []*Rule
+	modTime time.Time
+	lastRun map[string]time.Time
+}
+
+func NewRuleEngine(client *Client, path string) (*RuleEngine, error) {
+	engine := &RuleEngine{
+		client:  client,
+		path:    path,
+		lastRun: make(map[string]time.Time),
+	}
+	err := engine.Load()
+	if err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Load (re)reads the rules file. On error the previously loaded rules stay active.
+func (e *RuleEngine) Load() error {
+	stat, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read rules file: %w", err)
+	}
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read rules file: %w", err)
+	}
+	var file RulesFile
+	// YAML is a superset of JSON, so this handles both formats
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("failed to parse rules file: %w", err)
+	}
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Match.Text != "" {
+			rule.textRegex, err = regexp.Compile(rule.Match.Text)
+			if err != nil {
+				return fmt.Errorf("invalid text regex in %s: %w", rule.Name, err)
+			}
+		}
+		if window := rule.Match.TimeWindow; window != nil {
+			if _, err = parseClock(window.From); err != nil {
+				return fmt.Errorf("invalid time window in %s: %w", rule.Name, err)
+			} else if _, err = parseClock(window.To); err != nil {
+				return fmt.Errorf("invalid time window in %s: %w", rule.Name, err)
+			}
+		}
+		for _, action := range rule.Actions {
+			switch action.Type {
+			case "reply", "react", "forward", "mark_read", "label_chat":
+			case "webhook":
+				target, err := url.Parse(action.URL)
+				if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+					return fmt.Errorf("invalid webhook url %q in %s", action.URL, rule.Name)
+				}
+			default:
+				return fmt.Errorf("unknown action %q in %s", action.Type, rule.Name)
+			}
+		}
+	}
+
+	e.lock.Lock()
+	e.rules = file.Rules
+	e.modTime = stat.ModTime()
+	e.lock.Unlock()
+	e.client.Logger.Infof("Loaded %d rules from %s", len(file.Rules), e.path)
+	return nil
+}
+
+// Watch reloads the rules file whenever its modification time changes.
+func (e *RuleEngine) Watch() {
+	for {
+		time.Sleep(rulesReloadInterval)
+		stat, err := os.Stat(e.path)
+		if err != nil {
+			continue
+		}
+		e.lock.Lock()
+		changed := !stat.ModTime().Equal(e.modTime)
+		e.lock.Unlock()
+		if changed {
+			if err = e.Load(); err != nil {
+				e.client.Logger.Errorf("Failed to reload rules, keeping previous rules: %v", err)
+				e.lock.Lock()
+				e.modTime = stat.ModTime()
+				e.lock.Unlock()
+			}
+		}
+	}
+}
+
+// parseClock parses "HH:MM" into the duration since midnight.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether now is inside the window. The hours after midnight of a
+// window that spans midnight belong to the day the window starts on.
+func (w *TimeWindow) contains(now time.Time) bool {
+	from, _ := parseClock(w.From)
+	to, _ := parseClock(w.To)
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	start := now
+	if from <= to {
+		if sinceMidnight < from || sinceMidnight >= to {
+			return false
+		}
+	} else if sinceMidnight < to {
+		start = now.AddDate(0, 0, -1)
+	} else if sinceMidnight < from {
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	startDay := strings.ToLower(start.Weekday().String()[:3])
+	for _, day := range w.Days {
+		if strings.ToLower(day)[:min(3, len(day))] == startDay {
+			return true
+		}
+	}
+	return false
+}
+
+func chatType(chat types.JID) string {
+	switch {
+	case chat.String() == "status@broadcast":
+		return "status"
+	case chat.Server == types.GroupServer:
+		return "group"
+	case chat.Server == types.NewsletterServer:
+		return "newsletter"
+	default:
+		return "private"
+	}
+}
+
+func containsJID(list []string, jid types.JID) bool {
+	for _, item := range list {
+		parsed, ok := utils.ParseJID(item)
+		if ok && parsed.User == jid.User && parsed.Server == jid.Server {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matches(evt *events.Message, msgType, text string, now time.Time) bool {
+	match := r.Match
+	if len(match.Senders) > 0 && !containsJID(match.Senders, evt.Info.Sender.ToNonAD()) {
+		return false
+	}
+	if len(match.Groups) > 0 && !containsJID(match.Groups, evt.Info.Chat) {
+		return false
+	}
+	if match.ChatType != "" && match.ChatType != chatType(evt.Info.Chat) {
+		return false
+	}
+	if len(match.MessageTypes) > 0 {
+		found := false
+		for _, t := range match.MessageTypes {
+			if t == msgType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.textRegex != nil && !r.textRegex.MatchString(text) {
+		return false
+	}
+	if match.TimeWindow != nil && !match.TimeWindow.contains(now) {
+		return false
+	}
+	return true
+}
+
+// Apply runs the actions of every rule matching a received message.
+func (e *RuleEngine) Apply(evt *events.Message) {
+	if evt.Info.IsFromMe {
+		return
+	}
+	msgType, text, _ := messageContent(evt.Message)
+	now := time.Now()
+
+	e.lock.Lock()
+	var matched []*Rule
+	for _, rule := range e.rules {
+		if !rule.matches(evt, msgType, text, now) {
+			continue
+		}
+		cooldownKey := rule.Name + "|" + evt.Info.Chat.String()
+		if rule.Cooldown > 0 && now.Sub(e.lastRun[cooldownKey]) < rule.Cooldown {
+			continue
+		}
+		e.lastRun[cooldownKey] = now
+		matched = append(matched, rule)
+		if rule.Stop {
+			break
+		}
+	}
+	e.lock.Unlock()
+
+	values := map[string]string{
+		"pushname":   evt.Info.PushName,
+		"sender":     evt.Info.Sender.ToNonAD().String(),
+		"chat":       evt.Info.Chat.String(),
+		"text":       text,
+		"message_id": evt.Info.ID,
+	}
+	for _, rule := range matched {
+		e.client.Logger.Infof("Rule %q matched message %s from %s", rule.Name, evt.Info.ID, evt.Info.SourceString())
+		for _, action := range rule.Actions {
+			err := e.runAction(rule, action, evt, msgType, text, values)
+			if err != nil {
+				e.client.Logger.Errorf("Rule %q: %s action failed: %v", rule.Name, action.Type, err)
+			}
+		}
+	}
+}
+
+func (e *RuleEngine) runAction(rule *Rule, action RuleAction, evt *events.Message, msgType, text string, values map[string]string) error {
+	c := e.client
+	chat := evt.Info.Chat.String()
+	var err error
+	switch action.Type {
+	case "reply":
+		_, err = c.handleSendCommand([]string{chat, utils.FillTemplate(action.Text, values)})
+	case "react":
+		_, err = c.handleReactCommand([]string{chat, evt.Info.ID, action.Emoji})
+	case "forward":
+		to, ok := utils.ParseJID(utils.FillTemplate(action.To, values))
+		if !ok {
+			return fmt.Errorf("invalid forward target %s", action.To)
+		}
+		_, err = c.sendMessage(to, evt.Message)
+	case "mark_read":
+		_, err = c.handleMarkReadCommand([]string{chat, evt.Info.ID})
+	case "label_chat":
+		_, err = c.handleLabelChatCommand([]string{chat, action.Label, "true"})
+	case "webhook":
+		event := c.newMessageEvent(evt, evt.Message)
+		event.Type = "rule_matched"
+		event.Text = text
+		event.Sender.JID = evt.Info.Sender.ToNonAD().String()
+		event.Rule = &WebhookRule{Name: rule.Name, MessageType: msgType}
+		var body string
+		body, err = c.encodeWebhookEvent(event)
+		if err == nil {
+			go c.deliverWebhook(&WebhookDelivery{URL: action.URL, Body: body, Created: time.Now()})
+		}
+	}
+	return err
+}
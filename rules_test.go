@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// monday returns the given time of day on Monday, 3 June 2024.
+func monday(hour, minute int) time.Time {
+	return time.Date(2024, time.June, 3, hour, minute, 0, 0, time.Local)
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	tests := []struct {
+		name   string
+		window TimeWindow
+		at     time.Time
+		want   bool
+	}{
+		{"inside", TimeWindow{From: "09:00", To: "17:00"}, monday(12, 0), true},
+		{"at start", TimeWindow{From: "09:00", To: "17:00"}, monday(9, 0), true},
+		{"at end", TimeWindow{From: "09:00", To: "17:00"}, monday(17, 0), false},
+		{"before", TimeWindow{From: "09:00", To: "17:00"}, monday(8, 59), false},
+		{"overnight late", TimeWindow{From: "22:00", To: "06:00"}, monday(23, 30), true},
+		{"overnight early", TimeWindow{From: "22:00", To: "06:00"}, monday(5, 59), true},
+		{"overnight outside", TimeWindow{From: "22:00", To: "06:00"}, monday(12, 0), false},
+		{"matching day", TimeWindow{Days: []string{"Mon", "tue"}, From: "00:00", To: "23:59"}, monday(12, 0), true},
+		{"full day name", TimeWindow{Days: []string{"monday"}, From: "00:00", To: "23:59"}, monday(12, 0), true},
+		{"other day", TimeWindow{Days: []string{"sat", "sun"}, From: "00:00", To: "23:59"}, monday(12, 0), false},
+		{"overnight on its day", TimeWindow{Days: []string{"mon"}, From: "22:00", To: "06:00"}, monday(23, 0), true},
+		{"overnight after midnight", TimeWindow{Days: []string{"sun"}, From: "22:00", To: "06:00"}, monday(5, 0), true},
+		{"overnight after midnight of other day", TimeWindow{Days: []string{"mon"}, From: "22:00", To: "06:00"}, monday(5, 0), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.window.contains(test.at); got != test.want {
+				t.Errorf("contains(%s) = %v, want %v", test.at.Format("Mon 15:04"), got, test.want)
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	user := types.NewADJID("111", 0, 2)
+	group := types.NewJID("999", types.GroupServer)
+	private := &events.Message{Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: user.ToNonAD(), Sender: user}}}
+	inGroup := &events.Message{Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: group, Sender: user, IsGroup: true}}}
+
+	tests := []struct {
+		name  string
+		match RuleMatch
+		evt   *events.Message
+		text  string
+		want  bool
+	}{
+		{"empty", RuleMatch{}, private, "hi", true},
+		{"sender by phone", RuleMatch{Senders: []string{"111"}}, private, "hi", true},
+		{"sender by JID", RuleMatch{Senders: []string{"111@s.whatsapp.net"}}, inGroup, "hi", true},
+		{"other sender", RuleMatch{Senders: []string{"222"}}, private, "hi", false},
+		{"group", RuleMatch{Groups: []string{"999@g.us"}}, inGroup, "hi", true},
+		{"other group", RuleMatch{Groups: []string{"888@g.us"}}, inGroup, "hi", false},
+		{"chat type", RuleMatch{ChatType: "group"}, inGroup, "hi", true},
+		{"wrong chat type", RuleMatch{ChatType: "group"}, private, "hi", false},
+		{"message type", RuleMatch{MessageTypes: []string{"image", "text"}}, private, "hi", true},
+		{"wrong message type", RuleMatch{MessageTypes: []string{"image"}}, private, "hi", false},
+		{"text", RuleMatch{Text: `(?i)^price\b`}, private, "Price list please", true},
+		{"wrong text", RuleMatch{Text: `(?i)^price\b`}, private, "what's the price", false},
+		{"time window", RuleMatch{TimeWindow: &TimeWindow{From: "09:00", To: "17:00"}}, private, "hi", true},
+		{"outside time window", RuleMatch{TimeWindow: &TimeWindow{From: "18:00", To: "20:00"}}, private, "hi", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := &Rule{Match: test.match}
+			if test.match.Text != "" {
+				rule.textRegex = regexp.MustCompile(test.match.Text)
+			}
+			if got := rule.matches(test.evt, "text", test.text, monday(12, 0)); got != test.want {
+				t.Errorf("matches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRuleEngineLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{"valid", "rules:\n  - name: hi\n    match: {text: '^hi'}\n    actions: [{type: reply, text: hello}]\n", ""},
+		{"json", `{"rules": [{"actions": [{"type": "webhook", "url": "https://example.com/hook"}]}]}`, ""},
+		{"invalid regex", "rules:\n  - name: bad\n    match: {text: '('}\n", "invalid text regex in bad"},
+		{"invalid time window", "rules:\n  - match: {time_window: {from: '9am', to: '17:00'}}\n", "invalid time window in rule 1"},
+		{"unknown action", "rules:\n  - actions: [{type: shout}]\n", `unknown action "shout" in rule 1`},
+		{"webhook without url", "rules:\n  - actions: [{type: webhook}]\n", `invalid webhook url "" in rule 1`},
+		{"webhook with relative url", "rules:\n  - actions: [{type: webhook, url: /hook}]\n", `invalid webhook url "/hook"`},
+		{"webhook with other scheme", "rules:\n  - actions: [{type: webhook, url: 'ftp://example.com'}]\n", `invalid webhook url "ftp://example.com"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(path, []byte(test.rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewRuleEngine(&Client{Logger: waLog.Noop}, path)
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("NewRuleEngine() error = %v", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("NewRuleEngine() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
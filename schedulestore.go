@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Scheduled job states.
+const (
+	ScheduleStatusActive  = "active"
+	ScheduleStatusRunning = "running"
+	ScheduleStatusDone    = "done"
+	ScheduleStatusSkipped = "skipped"
+)
+
+// ScheduledJob is a command that runs at a given time, or repeatedly if Cron is set.
+type ScheduledJob struct {
+	ID        string    `json:"id"`
+	When      string    `json:"when"`
+	Cron      string    `json:"cron,omitempty"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	Status    string    `json:"status"`
+	NextRun   time.Time `json:"next_run"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// ScheduleStore persists scheduled jobs so they survive restarts.
+type ScheduleStore struct {
+	db *sql.DB
+}
+
+func NewScheduleStore(db *sql.DB) *ScheduleStore {
+	return &ScheduleStore{db: db}
+}
+
+func (s *ScheduleStore) Upgrade() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS wahelper_schedules (
+		job_id     TEXT PRIMARY KEY,
+		spec       TEXT   NOT NULL,
+		cron       TEXT   NOT NULL DEFAULT '',
+		command    TEXT   NOT NULL,
+		args       TEXT   NOT NULL DEFAULT '[]',
+		status     TEXT   NOT NULL,
+		next_run   BIGINT NOT NULL,
+		last_run   BIGINT NOT NULL DEFAULT 0,
+		last_error TEXT   NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schedule table: %w", err)
+	}
+	return nil
+}
+
+func (s *ScheduleStore) AddJob(job *ScheduledJob) error {
+	argsJSON, err := json.Marshal(job.Args)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO wahelper_schedules (job_id, spec, cron, command, args, status, next_run, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		job.ID, job.When, job.Cron, job.Command, string(argsJSON), job.Status, job.NextRun.Unix(), job.Created.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save scheduled job: %w", err)
+	}
+	return nil
+}
+
+// DeleteJob removes a job. It returns false if the job didn't exist.
+func (s *ScheduleStore) DeleteJob(id string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM wahelper_schedules WHERE job_id=$1`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// ClaimJob takes a due job before it runs by setting its status and next run time,
+// so that it isn't picked up again, also by another process sharing the database.
+// It returns false if the job was already claimed or changed since it was read.
+func (s *ScheduleStore) ClaimJob(job *ScheduledJob, status string, nextRun time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE wahelper_schedules SET status=$1, next_run=$2 WHERE job_id=$3 AND status=$4 AND next_run=$5`,
+		status, nextRun.Unix(), job.ID, ScheduleStatusActive, job.NextRun.Unix())
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// UpdateJob records the outcome of a run along with the new status and next run time.
+func (s *ScheduleStore) UpdateJob(id, status string, nextRun, lastRun time.Time, lastError string) error {
+	_, err := s.db.Exec(`UPDATE wahelper_schedules SET status=$1, next_run=$2, last_run=$3, last_error=$4 WHERE job_id=$5`,
+		status, nextRun.Unix(), lastRun.Unix(), lastError, id)
+	return err
+}
+
+// GetJobs returns jobs ordered by their next run. If dueBefore is non-zero, only
+// active jobs due at or before it are returned, otherwise active jobs, or all jobs
+// if includeFinished is set.
+func (s *ScheduleStore) GetJobs(dueBefore time.Time, includeFinished bool) ([]*ScheduledJob, error) {
+	query := `SELECT job_id, spec, cron, command, args, status, next_run, last_run, last_error, created_at FROM wahelper_schedules`
+	var params []interface{}
+	if !dueBefore.IsZero() {
+		query += ` WHERE status=$1 AND next_run<=$2`
+		params = append(params, ScheduleStatusActive, dueBefore.Unix())
+	} else if !includeFinished {
+		query += ` WHERE status=$1`
+		params = append(params, ScheduleStatusActive)
+	}
+	rows, err := s.db.Query(query+` ORDER BY next_run`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*ScheduledJob
+	for rows.Next() {
+		var job ScheduledJob
+		var argsJSON string
+		var nextRun, lastRun, created int64
+		err = rows.Scan(&job.ID, &job.When, &job.Cron, &job.Command, &argsJSON, &job.Status, &nextRun, &lastRun, &job.LastError, &created)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(argsJSON), &job.Args); err != nil {
+			return nil, fmt.Errorf("failed to parse arguments of job %s: %w", job.ID, err)
+		}
+		job.NextRun = time.Unix(nextRun, 0)
+		if lastRun > 0 {
+			job.LastRun = time.Unix(lastRun, 0)
+		}
+		job.Created = time.Unix(created, 0)
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
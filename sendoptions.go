@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+	"wahelper/utils"
+)
+
+// recentMessageCacheSize is how many sent and received messages are kept in memory
+// so that replies can quote them with their full content.
+const recentMessageCacheSize = 1000
+
+// SendOptions are the options shared by all send commands.
+type SendOptions struct {
+	// ReplyTo is the ID of the message to quote.
+	ReplyTo string
+	// ReplySender and ReplyText describe the quoted message when it isn't known locally.
+	ReplySender string
+	ReplyText   string
+	// NoMentions sends @ in the text as is instead of turning it into mentions.
+	NoMentions bool
+}
+
+// parseSendOptions removes the shared send options from args, wherever they appear.
+func parseSendOptions(args []string) ([]string, *SendOptions, error) {
+	opts := &SendOptions{}
+	remaining := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		var target *string
+		switch args[i] {
+		case "--no-mentions":
+			opts.NoMentions = true
+			continue
+		case "--reply-to":
+			target = &opts.ReplyTo
+		case "--reply-sender":
+			target = &opts.ReplySender
+		case "--reply-text":
+			target = &opts.ReplyText
+		default:
+			remaining = append(remaining, args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, nil, fmt.Errorf("missing value for %s", args[i])
+		}
+		i++
+		*target = args[i]
+	}
+	return remaining, opts, nil
+}
+
+// cacheRecentMessage remembers a sent or received message for quoting, evicting the oldest one when full.
+func (c *Client) cacheRecentMessage(evt *events.Message) {
+	c.recentLock.Lock()
+	defer c.recentLock.Unlock()
+	if _, ok := c.recentMessages[evt.Info.ID]; !ok {
+		if len(c.recentOrder) >= recentMessageCacheSize {
+			delete(c.recentMessages, c.recentOrder[0])
+			c.recentOrder = c.recentOrder[1:]
+		}
+		c.recentOrder = append(c.recentOrder, evt.Info.ID)
+	}
+	c.recentMessages[evt.Info.ID] = evt
+}
+
+func (c *Client) getRecentMessage(id types.MessageID) *events.Message {
+	c.recentLock.Lock()
+	defer c.recentLock.Unlock()
+	return c.recentMessages[id]
+}
+
+// ensureContextInfo returns the ContextInfo of msg, creating it if needed. Plain
+// conversation messages are turned into extended text messages, which can carry one.
+// It returns nil for message types without a ContextInfo.
+func ensureContextInfo(msg *waProto.Message) *waProto.ContextInfo {
+	if msg.Conversation != nil {
+		msg.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: msg.Conversation}
+		msg.Conversation = nil
+	}
+	ctxInfo := contextInfoField(msg)
+	if ctxInfo == nil {
+		return nil
+	}
+	if *ctxInfo == nil {
+		*ctxInfo = &waProto.ContextInfo{}
+	}
+	return *ctxInfo
+}
+
+// contextInfoField returns where the ContextInfo of msg is stored, or nil if its type has none.
+func contextInfoField(msg *waProto.Message) **waProto.ContextInfo {
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		return &msg.ExtendedTextMessage.ContextInfo
+	case msg.ImageMessage != nil:
+		return &msg.ImageMessage.ContextInfo
+	case msg.VideoMessage != nil:
+		return &msg.VideoMessage.ContextInfo
+	case msg.AudioMessage != nil:
+		return &msg.AudioMessage.ContextInfo
+	case msg.DocumentMessage != nil:
+		return &msg.DocumentMessage.ContextInfo
+	case msg.StickerMessage != nil:
+		return &msg.StickerMessage.ContextInfo
+	case msg.LocationMessage != nil:
+		return &msg.LocationMessage.ContextInfo
+	case msg.LiveLocationMessage != nil:
+		return &msg.LiveLocationMessage.ContextInfo
+	case msg.ContactMessage != nil:
+		return &msg.ContactMessage.ContextInfo
+	case msg.ContactsArrayMessage != nil:
+		return &msg.ContactsArrayMessage.ContextInfo
+	case msg.ListMessage != nil:
+		return &msg.ListMessage.ContextInfo
+	case msg.PollCreationMessage != nil:
+		return &msg.PollCreationMessage.ContextInfo
+	case msg.ButtonsResponseMessage != nil:
+		return &msg.ButtonsResponseMessage.ContextInfo
+	case msg.ListResponseMessage != nil:
+		return &msg.ListResponseMessage.ContextInfo
+	default:
+		return nil
+	}
+}
+
+// quotedContextInfo resolves the message to reply to, first from the recent message
+// cache, then from the message history, and finally from the supplied fields.
+func (c *Client) quotedContextInfo(chat types.JID, opts *SendOptions) (*waProto.ContextInfo, error) {
+	var sender, quotedChat types.JID
+	var quoted *waProto.Message
+	if recent := c.getRecentMessage(opts.ReplyTo); recent != nil {
+		sender, quotedChat, quoted = recent.Info.Sender, recent.Info.Chat, recent.Message
+	} else if stored, err := c.History.GetMessage(opts.ReplyTo); err != nil {
+		return nil, fmt.Errorf("failed to look up message %s: %w", opts.ReplyTo, err)
+	} else if stored != nil {
+		sender, _ = types.ParseJID(stored.Sender)
+		quotedChat, _ = types.ParseJID(stored.Chat)
+		quoted = &waProto.Message{Conversation: proto.String(stored.Text)}
+	}
+
+	if opts.ReplySender != "" {
+		var ok bool
+		sender, ok = utils.ParseJID(opts.ReplySender)
+		if !ok {
+			return nil, fmt.Errorf("invalid reply sender: %s", opts.ReplySender)
+		}
+	}
+	if opts.ReplyText != "" {
+		quoted = &waProto.Message{Conversation: proto.String(opts.ReplyText)}
+	}
+	if sender.IsEmpty() {
+		if chat.Server == types.GroupServer {
+			return nil, fmt.Errorf("unknown message %s, pass --reply-sender with the JID of its sender", opts.ReplyTo)
+		}
+		// In a private chat a message we don't know about was most likely sent by the other side
+		sender = chat
+	}
+	if quoted == nil {
+		quoted = &waProto.Message{Conversation: proto.String("")}
+	}
+
+	ctxInfo := &waProto.ContextInfo{
+		StanzaId:      proto.String(opts.ReplyTo),
+		Participant:   proto.String(sender.ToNonAD().String()),
+		QuotedMessage: quoted,
+	}
+	if !quotedChat.IsEmpty() && quotedChat != chat {
+		ctxInfo.RemoteJid = proto.String(quotedChat.String())
+	}
+	return ctxInfo, nil
+}
+
+// applySendOptions adds the shared send options to msg before it's sent to chat.
+func (c *Client) applySendOptions(chat types.JID, msg *waProto.Message, opts *SendOptions) error {
+	if opts == nil || !opts.NoMentions {
+		c.applyMentions(msg)
+	}
+	if opts == nil || opts.ReplyTo == "" {
+		return nil
+	}
+	quotedInfo, err := c.quotedContextInfo(chat, opts)
+	if err != nil {
+		return err
+	}
+	ctxInfo := ensureContextInfo(msg)
+	if ctxInfo == nil {
+		return fmt.Errorf("this message type can't be sent as a reply")
+	}
+	ctxInfo.StanzaId = quotedInfo.StanzaId
+	ctxInfo.Participant = quotedInfo.Participant
+	ctxInfo.QuotedMessage = quotedInfo.QuotedMessage
+	ctxInfo.RemoteJid = quotedInfo.RemoteJid
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// webhookQueueInterval is how often deliveries that exhausted their retries are attempted again.
+const webhookQueueInterval = 30 * time.Second
+
+// WebhookDelivery is a single event POSTed to a webhook target. Deliveries that keep
+// failing are persisted as JSON files in the webhook queue directory.
+type WebhookDelivery struct {
+	URL      string    `json:"url"`
+	Body     string    `json:"body"`
+	Created  time.Time `json:"created"`
+	Attempts int       `json:"attempts"`
+}
+
+var webhookQueueSeq atomic.Uint64
+
+// webhookTargets returns the URLs events should be posted to. Without any --webhook-url
+// events aren't forwarded at all: wahelper's own port doesn't accept them.
+func (c *Client) webhookTargets() []string {
+	return c.Config.WebhookURLs
+}
+
+// webhookStatusError is a delivery rejected by the target with a non-2xx status.
+type webhookStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// isPermanentWebhookError reports whether retrying a delivery that failed with err is
+// pointless. Client errors are, except for timeouts and rate limiting.
+func isPermanentWebhookError(err error) bool {
+	statusErr, ok := err.(*webhookStatusError)
+	if !ok {
+		return false
+	}
+	code := statusErr.StatusCode
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// postWebhook makes a single delivery attempt.
+func (c *Client) postWebhook(delivery *WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader([]byte(delivery.Body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature := c.signPayload([]byte(delivery.Body)); signature != "" {
+		req.Header.Set(signatureHeader, signature)
+	}
+	for _, header := range c.Config.WebhookHeaders {
+		name, value, found := strings.Cut(header, ":")
+		if !found {
+			continue
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	client := &http.Client{Timeout: c.Config.WebhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &webhookStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// deliverWebhook posts the delivery, retrying with exponential backoff, and queues it
+// on disk once all retries have failed.
+func (c *Client) deliverWebhook(delivery *WebhookDelivery) {
+	backoff := time.Second
+	for {
+		delivery.Attempts++
+		err := c.postWebhook(delivery)
+		if err == nil {
+			return
+		}
+		if isPermanentWebhookError(err) {
+			c.Logger.Errorf("Dropping webhook to %s rejected by the target: %v", delivery.URL, err)
+			return
+		}
+		if delivery.Attempts > c.Config.WebhookRetries {
+			c.Logger.Errorf("Failed to deliver webhook to %s after %d attempts, queueing: %v", delivery.URL, delivery.Attempts, err)
+			break
+		}
+		c.Logger.Warnf("Failed to deliver webhook to %s (attempt %d), retrying in %s: %v", delivery.URL, delivery.Attempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	err := c.enqueueWebhook(delivery)
+	if err != nil {
+		c.Logger.Errorf("Failed to queue webhook delivery: %v", err)
+	}
+}
+
+func (c *Client) enqueueWebhook(delivery *WebhookDelivery) error {
+	err := os.MkdirAll(c.Config.WebhookQueueDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook queue directory: %w", err)
+	}
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	if c.Config.WebhookQueueMax > 0 {
+		c.trimWebhookQueue(c.Config.WebhookQueueMax - 1)
+	}
+	// File names sort in creation order, so queued events are redelivered in order
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), webhookQueueSeq.Add(1)%1000000)
+	return os.WriteFile(filepath.Join(c.Config.WebhookQueueDir, name), data, 0644)
+}
+
+// queuedWebhooks returns the names of the queued deliveries, oldest first.
+func (c *Client) queuedWebhooks() ([]string, error) {
+	entries, err := os.ReadDir(c.Config.WebhookQueueDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// trimWebhookQueue drops the oldest queued deliveries until at most max are left.
+func (c *Client) trimWebhookQueue(max int) {
+	names, err := c.queuedWebhooks()
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(names)-max; i++ {
+		c.Logger.Warnf("Webhook queue is full, dropping %s", names[i])
+		os.Remove(filepath.Join(c.Config.WebhookQueueDir, names[i]))
+	}
+}
+
+// flushWebhookQueue attempts every queued delivery once, oldest first. It stops at the
+// first failure for a target so that events for that target are not reordered.
+func (c *Client) flushWebhookQueue() {
+	names, err := c.queuedWebhooks()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.Logger.Errorf("Failed to read webhook queue: %v", err)
+		}
+		return
+	}
+
+	failedTargets := make(map[string]bool)
+	for _, name := range names {
+		path := filepath.Join(c.Config.WebhookQueueDir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			c.Logger.Errorf("Failed to read queued webhook %s: %v", path, err)
+			continue
+		}
+		var delivery WebhookDelivery
+		err = json.Unmarshal(data, &delivery)
+		if err != nil {
+			c.Logger.Errorf("Dropping malformed queued webhook %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+		if time.Since(delivery.Created) > c.Config.WebhookQueueMaxAge {
+			c.Logger.Warnf("Dropping queued webhook to %s older than %s (queued at %s)", delivery.URL, c.Config.WebhookQueueMaxAge, delivery.Created)
+			os.Remove(path)
+			continue
+		}
+		if failedTargets[delivery.URL] {
+			continue
+		}
+		delivery.Attempts++
+		err = c.postWebhook(&delivery)
+		if isPermanentWebhookError(err) {
+			c.Logger.Errorf("Dropping queued webhook to %s rejected by the target: %v", delivery.URL, err)
+			os.Remove(path)
+			continue
+		} else if err != nil {
+			failedTargets[delivery.URL] = true
+			c.Logger.Debugf("Webhook target %s still unavailable: %v", delivery.URL, err)
+			continue
+		}
+		c.Logger.Infof("Delivered queued webhook to %s (queued at %s)", delivery.URL, delivery.Created)
+		os.Remove(path)
+	}
+}
+
+// RunWebhookQueue periodically redelivers queued webhook events.
+func (c *Client) RunWebhookQueue() {
+	for {
+		c.flushWebhookQueue()
+		time.Sleep(webhookQueueInterval)
+	}
+}
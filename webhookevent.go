@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// WebhookSchemaVersion is the version of the typed webhook payload. It is increased when
+// fields are renamed, removed or change meaning, not when new fields are added.
+const WebhookSchemaVersion = 2
+
+// WebhookEvent is the payload POSTed to webhook targets. Only the part matching Type
+// is set; with --webhook-schema=legacy it is flattened by Legacy instead.
+type WebhookEvent struct {
+	SchemaVersion int             `json:"schema_version"`
+	Type          string          `json:"type"`
+	MessageID     string          `json:"message_id,omitempty"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Port          int             `json:"port"`
+	Chat          *WebhookChat    `json:"chat,omitempty"`
+	Sender        *WebhookSender  `json:"sender,omitempty"`
+	IsFromMe      bool            `json:"is_from_me"`
+	IsStatus      bool            `json:"is_status"`
+	IsViewOnce    bool            `json:"is_view_once"`
+	IsEphemeral   bool            `json:"is_ephemeral"`
+	Context       *WebhookContext `json:"context,omitempty"`
+
+	Text              string                 `json:"text,omitempty"`
+	OriginalMessageID string                 `json:"original_message_id,omitempty"`
+	EditedType        string                 `json:"edited_type,omitempty"`
+	Media             *WebhookMedia          `json:"media,omitempty"`
+	Link              *WebhookLink           `json:"link,omitempty"`
+	Location          *WebhookLocation       `json:"location,omitempty"`
+	Contacts          *WebhookContacts       `json:"contacts,omitempty"`
+	Reaction          *WebhookReaction       `json:"reaction,omitempty"`
+	Poll              *WebhookPollVote       `json:"poll,omitempty"`
+	List              *WebhookListResponse   `json:"list,omitempty"`
+	Button            *WebhookButtonResponse `json:"button,omitempty"`
+	Rule              *WebhookRule           `json:"rule,omitempty"`
+	Receipt           *WebhookReceipt        `json:"receipt,omitempty"`
+	Group             *WebhookGroupChange    `json:"group,omitempty"`
+	Call              *WebhookCall           `json:"call,omitempty"`
+
+	// receiverJID is the legacy receiver_jid: the chat, or our own JID (Client.DefaultJID,
+	// taken from the device store on connect) for status broadcasts and incoming private messages.
+	receiverJID string
+}
+
+type WebhookChat struct {
+	JID       string `json:"jid"`
+	IsGroup   bool   `json:"is_group"`
+	GroupName string `json:"group_name,omitempty"`
+}
+
+type WebhookSender struct {
+	JID      string `json:"jid"`
+	PushName string `json:"push_name,omitempty"`
+}
+
+// WebhookContext describes what a message replies to, mentions and whether it was forwarded.
+type WebhookContext struct {
+	QuotedMessageID string   `json:"quoted_message_id,omitempty"`
+	QuotedSender    string   `json:"quoted_sender,omitempty"`
+	QuotedType      string   `json:"quoted_type,omitempty"`
+	QuotedText      string   `json:"quoted_text,omitempty"`
+	MentionedJIDs   []string `json:"mentioned_jids,omitempty"`
+	IsForwarded     bool     `json:"is_forwarded"`
+	ForwardingScore uint32   `json:"forwarding_score,omitempty"`
+}
+
+type WebhookMedia struct {
+	Kind       string `json:"kind"`
+	Path       string `json:"path,omitempty"`
+	MimeType   string `json:"mimetype"`
+	Caption    string `json:"caption,omitempty"`
+	FileLength uint64 `json:"file_length"`
+	SHA256     string `json:"sha256"`
+	IsAnimated bool   `json:"is_animated,omitempty"`
+}
+
+type WebhookLink struct {
+	MatchedText   string `json:"matched_text"`
+	CanonicalURL  string `json:"canonical_url"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	ThumbnailPath string `json:"thumbnail_path,omitempty"`
+}
+
+type WebhookLocation struct {
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Accuracy       uint32  `json:"accuracy"`
+	Name           string  `json:"name,omitempty"`
+	Address        string  `json:"address,omitempty"`
+	URL            string  `json:"url,omitempty"`
+	IsLive         bool    `json:"is_live"`
+	Speed          float32 `json:"speed,omitempty"`
+	Caption        string  `json:"caption,omitempty"`
+	SequenceNumber int64   `json:"sequence_number,omitempty"`
+	TimeOffset     uint32  `json:"time_offset,omitempty"`
+}
+
+type WebhookContacts struct {
+	DisplayName string  `json:"display_name"`
+	Contacts    []VCard `json:"contacts"`
+}
+
+type WebhookReaction struct {
+	Emoji           string `json:"emoji"`
+	Removed         bool   `json:"removed"`
+	TargetMessageID string `json:"target_message_id"`
+	TargetFromMe    bool   `json:"target_from_me"`
+}
+
+type WebhookPollVote struct {
+	PollMessageID   string        `json:"poll_message_id"`
+	Question        string        `json:"question"`
+	SelectedOptions []interface{} `json:"selected_options"`
+}
+
+type WebhookListResponse struct {
+	OriginMessageID     string `json:"origin_message_id"`
+	SelectedRowID       string `json:"selected_row_id"`
+	SelectedTitle       string `json:"selected_title"`
+	SelectedDescription string `json:"selected_description"`
+	Title               string `json:"title"`
+	Body                string `json:"body"`
+	Footer              string `json:"footer"`
+	ButtonText          string `json:"button_text"`
+	Header              string `json:"header"`
+}
+
+type WebhookButtonResponse struct {
+	OriginMessageID string `json:"origin_message_id"`
+	Selected        string `json:"selected"`
+	Title           string `json:"title"`
+	Body            string `json:"body"`
+	Footer          string `json:"footer"`
+}
+
+// WebhookReceipt reports that one or more of our messages were delivered, read or played.
+type WebhookReceipt struct {
+	Status     string   `json:"status"`
+	MessageIDs []string `json:"message_ids"`
+	Recipient  string   `json:"recipient"`
+}
+
+// WebhookGroupChange describes a change of a group, made by Actor if known.
+type WebhookGroupChange struct {
+	Action       string   `json:"action,omitempty"`
+	Participants []string `json:"participants,omitempty"`
+	Actor        string   `json:"actor,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Topic        string   `json:"topic,omitempty"`
+	Setting      string   `json:"setting,omitempty"`
+	Enabled      bool     `json:"enabled"`
+	InviteLink   string   `json:"invite_link,omitempty"`
+}
+
+// WebhookCall describes an incoming call and whether it was rejected by --reject-calls.
+type WebhookCall struct {
+	CallID   string `json:"call_id"`
+	Creator  string `json:"creator"`
+	IsVideo  bool   `json:"is_video"`
+	IsGroup  bool   `json:"is_group"`
+	Rejected bool   `json:"rejected"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type WebhookRule struct {
+	Name        string `json:"name"`
+	MessageType string `json:"message_type"`
+}
+
+// newWebhookEvent returns an event of the given type with the envelope filled in.
+func (c *Client) newWebhookEvent(eventType string) *WebhookEvent {
+	return &WebhookEvent{
+		SchemaVersion: WebhookSchemaVersion,
+		Type:          eventType,
+		Timestamp:     time.Now(),
+		Port:          c.Config.HTTPPort,
+	}
+}
+
+// newMessageEvent returns an event for a received message with the chat, sender
+// and context of content (the unwrapped evt.Message) filled in.
+func (c *Client) newMessageEvent(evt *events.Message, content *waProto.Message) *WebhookEvent {
+	event := c.newWebhookEvent("")
+	event.MessageID = evt.Info.ID
+	event.Timestamp = evt.Info.Timestamp
+	event.IsFromMe = evt.Info.IsFromMe
+	event.IsStatus = evt.Info.Chat.String() == "status@broadcast"
+	event.Sender = &WebhookSender{JID: evt.Info.Sender.String(), PushName: evt.Info.PushName}
+	event.Chat = &WebhookChat{JID: evt.Info.Chat.String(), IsGroup: evt.Info.IsGroup && !event.IsStatus}
+	if event.Chat.IsGroup {
+		event.Chat.GroupName = c.groupName(evt.Info.Chat)
+	}
+
+	event.receiverJID = event.Chat.JID
+	if event.IsStatus || (!event.IsFromMe && event.Sender.JID == event.Chat.JID && c.DefaultJID != "") {
+		event.receiverJID = c.DefaultJID
+	}
+
+	if content == nil {
+		return event
+	}
+	if field := contextInfoField(content); field != nil && *field != nil {
+		ctxInfo := *field
+		context := &WebhookContext{
+			QuotedMessageID: ctxInfo.GetStanzaId(),
+			QuotedSender:    ctxInfo.GetParticipant(),
+			MentionedJIDs:   ctxInfo.GetMentionedJid(),
+			IsForwarded:     ctxInfo.GetIsForwarded(),
+			ForwardingScore: ctxInfo.GetForwardingScore(),
+		}
+		if quoted := ctxInfo.GetQuotedMessage(); quoted != nil {
+			context.QuotedType, context.QuotedText, _ = messageContent(quoted)
+		}
+		if context.QuotedMessageID != "" || len(context.MentionedJIDs) > 0 || context.IsForwarded {
+			event.Context = context
+		}
+	}
+	return event
+}
+
+// Legacy flattens the event to the string-valued fields sent before schema_version
+// existed, so that receivers written against them (such as Tasker profiles) keep working.
+func (e *WebhookEvent) Legacy() map[string]interface{} {
+	data := map[string]interface{}{
+		"type": e.Type,
+		"port": fmt.Sprintf("%d", e.Port),
+	}
+	if e.Rule != nil {
+		// Rule webhooks always used real types and their own field names
+		data["rule"] = e.Rule.Name
+		data["message_type"] = e.Rule.MessageType
+		data["message"] = e.Text
+		data["message_id"] = e.MessageID
+		data["sender_jid"] = e.Sender.JID
+		data["sender_pushname"] = e.Sender.PushName
+		data["chat_jid"] = e.Chat.JID
+		data["time_stamp"] = e.Timestamp.Unix()
+		delete(data, "port")
+		return data
+	}
+	if e.MessageID != "" {
+		data["message_id"] = e.MessageID
+	}
+	data["time_stamp"] = fmt.Sprintf("%d", e.Timestamp.Unix())
+	if e.Chat != nil {
+		if e.receiverJID != "" {
+			data["receiver_jid"] = e.receiverJID
+		} else {
+			data["receiver_jid"] = e.Chat.JID
+		}
+		data["is_group"] = fmt.Sprintf("%t", e.Chat.IsGroup)
+		if e.Chat.IsGroup {
+			if e.Chat.GroupName != "" {
+				data["group_name"] = e.Chat.GroupName
+			} else {
+				data["group_name"] = "Unknown, Group Not Found"
+			}
+		}
+	}
+	if e.Sender != nil {
+		data["sender_jid"] = e.Sender.JID
+		data["sender_pushname"] = e.Sender.PushName
+		data["is_from_myself"] = fmt.Sprintf("%t", e.IsFromMe)
+		data["is_view_once"] = fmt.Sprintf("%t", e.IsViewOnce)
+		data["is_ephemeral"] = fmt.Sprintf("%t", e.IsEphemeral)
+	}
+
+	switch e.Type {
+	case "message_edited":
+		data["message"] = e.Text
+		data["edited_type"] = e.EditedType
+		data["original_message_id"] = e.OriginalMessageID
+	case "message_revoked":
+		data["original_message_id"] = e.OriginalMessageID
+	case "text_message", "status_message":
+		if e.Media == nil {
+			data["message"] = e.Text
+		}
+	}
+	if e.Link != nil {
+		data["path"] = e.Link.ThumbnailPath
+		data["message"] = e.Text
+		data["link_matched_text"] = e.Link.MatchedText
+		data["link_canonical_url"] = e.Link.CanonicalURL
+		data["link_description"] = e.Link.Description
+		data["link_title"] = e.Link.Title
+	}
+	if e.Media != nil {
+		if e.Media.Path != "" {
+			data["path"] = e.Media.Path
+			data["caption"] = e.Media.Caption
+		}
+		data["mimetype"] = e.Media.MimeType
+		data["file_length"] = fmt.Sprintf("%d", e.Media.FileLength)
+		data["sha256"] = e.Media.SHA256
+		if e.Media.Kind == "sticker" {
+			data["is_animated"] = fmt.Sprintf("%t", e.Media.IsAnimated)
+		}
+	}
+	if e.Location != nil {
+		data["latitude"] = e.Location.Latitude
+		data["longitude"] = e.Location.Longitude
+		data["accuracy"] = e.Location.Accuracy
+		if e.Location.IsLive {
+			data["speed"] = e.Location.Speed
+			data["caption"] = e.Location.Caption
+			data["sequence_number"] = e.Location.SequenceNumber
+			data["time_offset"] = e.Location.TimeOffset
+		} else {
+			data["location_name"] = e.Location.Name
+			data["location_address"] = e.Location.Address
+			data["location_url"] = e.Location.URL
+		}
+	}
+	if e.Contacts != nil {
+		data["display_name"] = e.Contacts.DisplayName
+		data["contacts"] = e.Contacts.Contacts
+	}
+	if e.Reaction != nil {
+		data["reaction"] = e.Reaction.Emoji
+		data["reaction_removed"] = fmt.Sprintf("%t", e.Reaction.Removed)
+		data["target_message_id"] = e.Reaction.TargetMessageID
+		data["target_from_me"] = fmt.Sprintf("%t", e.Reaction.TargetFromMe)
+	}
+	if e.Poll != nil {
+		// Legacy poll votes carried the poll's ID, not the vote's
+		data["message_id"] = e.Poll.PollMessageID
+		data["poll_question"] = e.Poll.Question
+		data["poll_selected_options"] = e.Poll.SelectedOptions
+	}
+	if e.List != nil {
+		data["list_selected_title"] = e.List.SelectedTitle
+		data["list_selected_description"] = e.List.SelectedDescription
+		data["list_selected_row_id"] = e.List.SelectedRowID
+		data["list_title"] = e.List.Title
+		data["list_body"] = e.List.Body
+		data["list_footer"] = e.List.Footer
+		data["list_button_text"] = e.List.ButtonText
+		data["list_header"] = e.List.Header
+		data["origin_message_id"] = e.List.OriginMessageID
+	}
+	if e.Receipt != nil {
+		data["receipt_status"] = e.Receipt.Status
+		data["message_ids"] = e.Receipt.MessageIDs
+		data["recipient_jid"] = e.Receipt.Recipient
+	}
+	if e.Group != nil {
+		data["group_action"] = e.Group.Action
+		data["group_participants"] = e.Group.Participants
+		data["group_actor"] = e.Group.Actor
+		data["group_reason"] = e.Group.Reason
+		data["group_subject"] = e.Group.Name
+		data["group_description"] = e.Group.Topic
+		data["group_setting"] = e.Group.Setting
+		data["group_setting_enabled"] = fmt.Sprintf("%t", e.Group.Enabled)
+		data["group_invite_link"] = e.Group.InviteLink
+	}
+	if e.Call != nil {
+		data["call_id"] = e.Call.CallID
+		data["call_creator"] = e.Call.Creator
+		data["call_is_video"] = fmt.Sprintf("%t", e.Call.IsVideo)
+		data["call_is_group"] = fmt.Sprintf("%t", e.Call.IsGroup)
+		data["call_rejected"] = fmt.Sprintf("%t", e.Call.Rejected)
+		data["call_reason"] = e.Call.Reason
+	}
+	if e.Button != nil {
+		data["button_selected_button"] = e.Button.Selected
+		data["button_title"] = e.Button.Title
+		data["button_body"] = e.Button.Body
+		data["button_footer"] = e.Button.Footer
+		data["origin_message_id"] = e.Button.OriginMessageID
+	}
+	return data
+}
+
+// encodeWebhookEvent serializes event in the format selected by --webhook-schema.
+func (c *Client) encodeWebhookEvent(event *WebhookEvent) (string, error) {
+	var body []byte
+	var err error
+	if c.Config.WebhookSchema == "legacy" {
+		body, err = json.Marshal(event.Legacy())
+	} else {
+		body, err = json.Marshal(event)
+	}
+	return string(body), err
+}
+
+// sendWebhookEvent posts event to the webhook targets.
+func (c *Client) sendWebhookEvent(event *WebhookEvent) {
+	body, err := c.encodeWebhookEvent(event)
+	if err != nil {
+		c.Logger.Errorf("Failed to encode %s webhook event: %v", event.Type, err)
+		return
+	}
+	c.Logger.Infof("%s", body)
+	c.sendHttpPost(body)
+}